@@ -0,0 +1,179 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/qjpcpu/log/logging"
+)
+
+// format names accepted by ConfigureFromEnv
+var formatNames = map[string]string{
+	"norm":       NormFormat,
+	"debug":      DebugFormat,
+	"color":      SimpleColorFormat,
+	"debugcolor": DebugColorFormat,
+	"cli":        CliFormat,
+	"json":       JSONFormat,
+}
+
+// rotate names accepted by ConfigureFromEnv
+var rotateNames = map[string]RotateType{
+	"daily":  RotateDaily,
+	"hourly": RotateHourly,
+	"weekly": RotateWeekly,
+	"none":   RotateNone,
+}
+
+// ConfigureFromEnv configure default logger and module loggers by environment variables:
+//
+//	LOG_LEVEL=info                      level of default logger
+//	LOG_FORMAT=json                     norm, debug, color, debugcolor, cli, json or a format string
+//	LOG_FILE=./log/app.log              log file, empty for stderr
+//	LOG_ERROR_FILE=./log/app.log.wf     error log file
+//	LOG_ROTATE=daily                    daily, hourly, weekly or none
+//	LOG_MODULES=db=debug,http*=warning  module levels, also applied to modules submitted later
+//
+// every variable name is prefixed by prefix, e.g. prefix "APP_" reads APP_LOG_LEVEL.
+// Invalid values are skipped and reported by the returned error.
+func ConfigureFromEnv(prefix string) error {
+	var errs []string
+	lookup := func(name string) (string, bool) {
+		v, ok := os.LookupEnv(prefix + name)
+		return strings.TrimSpace(v), ok
+	}
+	report := func(name string, err error) {
+		errs = append(errs, fmt.Sprintf("%s%s: %v", prefix, name, err))
+	}
+
+	opt := defaultOption()
+	changed := false
+	if v, ok := lookup("LOG_LEVEL"); ok {
+		if lvl, err := ParseLevel(v); err != nil {
+			report("LOG_LEVEL", err)
+		} else {
+			opt.Level, opt.levelSet, changed = lvl, true, true
+		}
+	}
+	if v, ok := lookup("LOG_FORMAT"); ok {
+		if format, err := parseFormat(v); err != nil {
+			report("LOG_FORMAT", err)
+		} else {
+			opt.Format, changed = format, true
+		}
+	}
+	if v, ok := lookup("LOG_FILE"); ok {
+		opt.LogFile, changed = v, true
+	}
+	if v, ok := lookup("LOG_ERROR_FILE"); ok {
+		opt.ErrorLogFile, changed = v, true
+	}
+	if v, ok := lookup("LOG_ROTATE"); ok {
+		if rt, err := parseRotate(v); err != nil {
+			report("LOG_ROTATE", err)
+		} else {
+			opt.SetRotate(rt)
+			changed = true
+		}
+	}
+	if changed {
+		opt.Submit()
+	}
+
+	if v, ok := lookup("LOG_MODULES"); ok {
+		levels, err := parseModuleLevels(v)
+		if err != nil {
+			report("LOG_MODULES", err)
+		}
+		setModuleLevels(levels)
+	}
+
+	if len(errs) > 0 {
+		return errors.New("log: invalid environment: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func parseFormat(s string) (string, error) {
+	if format, ok := formatNames[strings.ToLower(s)]; ok {
+		return format, nil
+	}
+	if strings.Contains(s, "%{") {
+		if _, err := logging.NewStringFormatter(s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown format %q", s)
+}
+
+func parseRotate(s string) (RotateType, error) {
+	if rt, ok := rotateNames[strings.ToLower(s)]; ok {
+		return rt, nil
+	}
+	return RotateNone, fmt.Errorf("unknown rotate type %q", s)
+}
+
+// parseModuleLevels parse module levels like "db=debug,http*=warning", module names may be
+// patterns as supported by logging.CompileModulePattern, valid entries are returned even if some
+// are invalid
+func parseModuleLevels(s string) ([]moduleLevel, error) {
+	var levels []moduleLevel
+	var invalid []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		pattern := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || pattern == "" {
+			invalid = append(invalid, item)
+			continue
+		}
+		match, err := logging.CompileModulePattern(pattern)
+		if err != nil {
+			invalid = append(invalid, item)
+			continue
+		}
+		lvl, err := ParseLevel(kv[1])
+		if err != nil {
+			invalid = append(invalid, item)
+			continue
+		}
+		levels = append(levels, moduleLevel{module: pattern, match: match, level: lvl})
+	}
+	if len(invalid) > 0 {
+		return levels, fmt.Errorf("invalid module levels %q", invalid)
+	}
+	return levels, nil
+}
+
+// setModuleLevels apply levels to submitted modules and remember them for modules submitted later
+func setModuleLevels(levels []moduleLevel) {
+	mloggers.Lock()
+	defer mloggers.Unlock()
+	for _, lvl := range levels {
+		mloggers.remember(lvl)
+	}
+	for module, wl := range mloggers.loggers {
+		if lvl, ok := mloggers.levelOf(module); ok {
+			wl.option.Level, wl.option.levelSet = lvl, true
+			wl.leveldBackend.SetLevel(lvl, "")
+		}
+	}
+}
+
+// remember records lvl for modules submitted later, replacing the level of the same name or
+// pattern, caller must hold the lock
+func (ml *moduleLoggers) remember(lvl moduleLevel) {
+	for i := range ml.levels {
+		if ml.levels[i].module == lvl.module {
+			ml.levels[i].level = lvl.level
+			return
+		}
+	}
+	ml.levels = append(ml.levels, lvl)
+}
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigureFromEnv(t *testing.T) {
+	defer SetLogLevel(GetLogLevel())
+	GetMBuilder("envdb").SetLevel("info").Submit()
+
+	t.Setenv("TEST_LOG_LEVEL", "warn")
+	t.Setenv("TEST_LOG_FORMAT", "json")
+	t.Setenv("TEST_LOG_MODULES", "envdb=debug, envhttp=error")
+	if err := ConfigureFromEnv("TEST_"); err != nil {
+		t.Fatal(err)
+	}
+	if GetLogLevel() != "warning" {
+		t.Errorf("unexpected level: %s", GetLogLevel())
+	}
+	if defaultLgr.option.Format != JSONFormat {
+		t.Errorf("unexpected format: %s", defaultLgr.option.Format)
+	}
+	if GetMLogLevel("envdb") != "debug" {
+		t.Errorf("unexpected module level: %s", GetMLogLevel("envdb"))
+	}
+
+	// modules submitted later pick up the level too
+	GetMBuilder("envhttp").SetLevel("info").Submit()
+	if GetMLogLevel("envhttp") != "error" {
+		t.Errorf("unexpected module level: %s", GetMLogLevel("envhttp"))
+	}
+
+	t.Setenv("TEST_LOG_LEVEL", "loud")
+	t.Setenv("TEST_LOG_FORMAT", "norm")
+	t.Setenv("TEST_LOG_ROTATE", "yearly")
+	t.Setenv("TEST_LOG_MODULES", "envdb=info,envhttp")
+	err := ConfigureFromEnv("TEST_")
+	if err == nil {
+		t.Fatal("expected error for invalid values")
+	}
+	for _, name := range []string{"TEST_LOG_LEVEL", "TEST_LOG_ROTATE", "TEST_LOG_MODULES"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("%s not reported: %v", name, err)
+		}
+	}
+	if GetLogLevel() != "warning" || defaultLgr.option.Format != NormFormat {
+		t.Errorf("unexpected default logger: %s %s", GetLogLevel(), defaultLgr.option.Format)
+	}
+	if GetMLogLevel("envdb") != "info" {
+		t.Errorf("valid module level not applied: %s", GetMLogLevel("envdb"))
+	}
+}
+
+func TestConfigureFromEnvClosesFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEST_LOG_FILE", filepath.Join(dir, "first.log"))
+	if err := ConfigureFromEnv("TEST_"); err != nil {
+		t.Fatal(err)
+	}
+	first := defaultLgr.option.files
+	if len(first) == 0 {
+		t.Fatal("log file not opened")
+	}
+
+	t.Setenv("TEST_LOG_FILE", filepath.Join(dir, "second.log"))
+	if err := ConfigureFromEnv("TEST_"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first[0].Write([]byte("x\n")); err == nil {
+		t.Error("file of the replaced logger not closed")
+	}
+
+	// back to stderr
+	t.Setenv("TEST_LOG_FILE", "")
+	if err := ConfigureFromEnv("TEST_"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"flag"
+)
+
+// optionFlag is a flag.Value applied to loggers as soon as the flag is parsed
+type optionFlag struct {
+	get func() string
+	set func(string) error
+}
+
+func (f *optionFlag) String() string {
+	if f.get == nil {
+		return ""
+	}
+	return f.get()
+}
+
+func (f *optionFlag) Set(s string) error {
+	return f.set(s)
+}
+
+// RegisterFlags add log flags to fs, flag.CommandLine if fs is nil:
+//
+//	-log.level=info                      level of default logger
+//	-log.file=./log/app.log              log file, empty for stderr
+//	-log.format=json                     norm, debug, color, debugcolor, cli, json or a format string
+//	-log.rotate=daily                    daily, hourly, weekly or none
+//	-log.vmodule=db=debug,http*=warning  module levels, module names may be glob patterns
+//
+// flags are applied to the default logger and module loggers when parsed, module levels are
+// also applied to modules submitted later. Each of -log.file, -log.format and -log.rotate
+// submits the default logger again, closing the files opened for the previous flag.
+func RegisterFlags(fs *flag.FlagSet) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	fs.Var(&optionFlag{
+		get: GetLogLevel,
+		set: SetLogLevel,
+	}, "log.level", "log level: critical, error, warning, notice, info, debug or trace")
+	fs.Var(&optionFlag{
+		get: func() string { return defaultLgr.option.LogFile },
+		set: func(s string) error {
+			opt := defaultOption()
+			opt.LogFile = s
+			return opt.Submit()
+		},
+	}, "log.file", "log file, log to stderr if empty")
+	fs.Var(&optionFlag{
+		get: func() string { return "" },
+		set: func(s string) error {
+			format, err := parseFormat(s)
+			if err != nil {
+				return err
+			}
+			opt := defaultOption()
+			opt.Format = format
+			return opt.Submit()
+		},
+	}, "log.format", "log format: norm, debug, color, debugcolor, cli, json or a format string")
+	fs.Var(&optionFlag{
+		get: func() string { return "" },
+		set: func(s string) error {
+			rt, err := parseRotate(s)
+			if err != nil {
+				return err
+			}
+			opt := defaultOption()
+			opt.SetRotate(rt)
+			return opt.Submit()
+		},
+	}, "log.rotate", "log file rotation: daily, hourly, weekly or none")
+	fs.Var(&optionFlag{
+		get: func() string { return "" },
+		set: func(s string) error {
+			levels, err := parseModuleLevels(s)
+			if err != nil {
+				return err
+			}
+			setModuleLevels(levels)
+			return nil
+		},
+	}, "log.vmodule", "comma separated module levels like db=debug,http*=warning")
+}
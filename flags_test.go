@@ -0,0 +1,67 @@
+package log
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegisterFlags(t *testing.T) {
+	defer SetLogLevel(GetLogLevel())
+	GetMBuilder("flagdb").SetLevel("info").Submit()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs)
+	err := fs.Parse([]string{
+		"-log.level=error",
+		"-log.format=cli",
+		"-log.rotate=hourly",
+		"-log.vmodule=flag*=warning,flagdb=debug",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if GetLogLevel() != "error" {
+		t.Errorf("unexpected level: %s", GetLogLevel())
+	}
+	if defaultLgr.option.Format != CliFormat || RotateType(defaultLgr.option.RotateType) != RotateHourly {
+		t.Errorf("unexpected options: %+v", defaultLgr.option)
+	}
+	if GetMLogLevel("flagdb") != "debug" {
+		t.Errorf("exact module name should take precedence: %s", GetMLogLevel("flagdb"))
+	}
+	GetMBuilder("flaghttp").SetLevel("info").Submit()
+	if GetMLogLevel("flaghttp") != "warning" {
+		t.Errorf("glob level not applied: %s", GetMLogLevel("flaghttp"))
+	}
+
+	for _, args := range [][]string{
+		{"-log.level=loud"},
+		{"-log.format=fancy"},
+		{"-log.rotate=yearly"},
+		{"-log.vmodule=db[=debug"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		RegisterFlags(fs)
+		if err := fs.Parse(args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func TestRegisterFlagsFile(t *testing.T) {
+	defer GetBuilder().Submit()
+	file := filepath.Join(t.TempDir(), "app.log")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"-log.file=" + file, "-log.format=%{message}"}); err != nil {
+		t.Fatal(err)
+	}
+	Infof("applied on parse")
+	data, _ := ioutil.ReadFile(file)
+	if string(data) != "applied on parse\n" {
+		t.Errorf("unexpected log file content %q", data)
+	}
+}
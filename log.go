@@ -15,13 +15,69 @@ import (
 
 type moduleLoggers struct {
 	loggers map[string]*logWrapper
+	// levels set by environment or flags, applied to modules submitted later too
+	levels []moduleLevel
 	*sync.RWMutex
 }
 
+type moduleLevel struct {
+	// module name or pattern, see logging.CompileModulePattern
+	module string
+	match  func(string) bool
+	level  Level
+}
+
 type logWrapper struct {
 	*logging.Logger
 	option        *LogOption
 	leveldBackend logging.LeveledBackend
+	backend       *swapBackend
+}
+
+// swapBackend forwards to the backend built from the options last submitted, loggers already
+// returned by M follow a new Submit and no record is written to the replaced backend once swapped
+type swapBackend struct {
+	mu      sync.RWMutex
+	backend logging.LeveledBackend
+}
+
+func (sb *swapBackend) Log(level Level, calldepth int, rec *logging.Record) error {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.backend.Log(level, calldepth+1, rec)
+}
+
+func (sb *swapBackend) GetLevel(module string) Level {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.backend.GetLevel(module)
+}
+
+func (sb *swapBackend) SetLevel(level Level, module string) {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	sb.backend.SetLevel(level, module)
+}
+
+func (sb *swapBackend) SetLevelRule(pattern string, level Level) error {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.backend.SetLevelRule(pattern, level)
+}
+
+func (sb *swapBackend) IsEnabledFor(level Level, module string) bool {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.backend.IsEnabledFor(level, module)
+}
+
+// replace makes wl use the backend and options of lgr, waiting for the records being written to
+// the replaced backend
+func (wl *logWrapper) replace(lgr *logWrapper) {
+	wl.backend.mu.Lock()
+	wl.backend.backend = lgr.backend.backend
+	wl.option, wl.leveldBackend = lgr.option, lgr.leveldBackend
+	wl.backend.mu.Unlock()
 }
 
 // package global variables
@@ -41,48 +97,38 @@ const (
 	DebugColorFormat = "\033[1;33m%{level}\033[0m \033[1;36m%{time:2006-01-02 15:04:05.000}\033[0m \033[0;34m%{shortfile}\033[0m \033[0;32mgrtid:%{goroutineid}/gcnt:%{goroutinecount}\033[0m %{message}"
 	// CliFormat simple format
 	CliFormat = "\033[1;33m%{level}\033[0m \033[1;36m%{time:2006-01-02 15:04:05}\033[0m \033[0;32m%{message}\033[0m"
+	// JSONFormat one json object per line, see logging.JSONFormatter
+	JSONFormat = "json"
 )
 
-// Level log level
-type Level int
+// Level log level, the same type as logging.Level.
+//
+// The levels are numbered as in logging, from CRITICAL = 0 to TRACE, one less
+// than the former log.Level which started at CRITICAL = 1. A LogOption whose
+// Level is left to the zero value logs at INFO, use SetTypedLevel(CRITICAL) or
+// SetLevel("critical") to log at CRITICAL.
+type Level = logging.Level
 
 const (
 	// CRITICAL level
-	CRITICAL Level = iota + 1
+	CRITICAL = logging.CRITICAL
 	// ERROR level
-	ERROR
+	ERROR = logging.ERROR
 	// WARNING level
-	WARNING
+	WARNING = logging.WARNING
 	// NOTICE level
-	NOTICE
+	NOTICE = logging.NOTICE
 	// INFO level
-	INFO
+	INFO = logging.INFO
 	// DEBUG level
-	DEBUG
+	DEBUG = logging.DEBUG
+	// TRACE level
+	TRACE = logging.TRACE
 )
 
-func (lvl Level) loggingLevel() logging.Level {
-	return logging.Level(lvl - 1)
-}
-
-func parseLogLevel(lstr string) Level {
-	lstr = strings.ToLower(lstr)
-	switch lstr {
-	case "critical":
-		return CRITICAL
-	case "error":
-		return ERROR
-	case "warning":
-		return WARNING
-	case "notice":
-		return NOTICE
-	case "info":
-		return INFO
-	case "debug":
-		return DEBUG
-	default:
-		return INFO
-	}
+// ParseLevel parse level name like "info", "warn" or "DEBU", see logging.ParseLevel
+func ParseLevel(lstr string) (Level, error) {
+	return logging.ParseLevel(lstr)
 }
 
 // LogOption log config options
@@ -93,8 +139,10 @@ type LogOption struct {
 	RotateType     filelog.RotateType
 	CreateShortcut bool
 	ErrorLogFile   string
+	levelSet       bool // Level set by SetLevel or SetTypedLevel, even to CRITICAL
 	files          []io.WriteCloser
 	module         string
+	err            error
 }
 
 // RotateType 轮转类型
@@ -130,15 +178,20 @@ func (lo *LogOption) SetFile(filename string) *LogOption {
 	return lo
 }
 
-// SetLevel set log level
+// SetLevel set log level, an invalid level is reported by Submit
 func (lo *LogOption) SetLevel(level string) *LogOption {
-	lo.Level = parseLogLevel(level)
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		lo.err = err
+		return lo
+	}
+	lo.Level, lo.levelSet = lvl, true
 	return lo
 }
 
 // SetTypedLevel set log level
 func (lo *LogOption) SetTypedLevel(level Level) *LogOption {
-	lo.Level = level
+	lo.Level, lo.levelSet = level, true
 	return lo
 }
 
@@ -166,17 +219,40 @@ func (lo *LogOption) SetErrorLog(f string) *LogOption {
 	return lo
 }
 
-// Submit use this buider options
-func (lo *LogOption) Submit() {
+// Submit use this buider options, invalid options are skipped and returned as error,
+// loggers already returned by M follow the new options and the replaced log files are closed
+func (lo *LogOption) Submit() error {
+	// the files of the replaced logger are closed once it is swapped out, lo may be its option
+	var replaced []io.WriteCloser
+	if lo.module == "" {
+		replaced = defaultLgr.option.files
+	} else {
+		mloggers.RLock()
+		if wl, ok := mloggers.loggers[lo.module]; ok {
+			replaced = wl.option.files
+		}
+		mloggers.RUnlock()
+	}
+	lo.files = nil
 	lgr := createLogger(lo)
 	if lo.module == "" {
-		defaultLgr = lgr
+		defaultLgr.replace(lgr)
 	} else {
 		lgr.ExtraCalldepth--
 		mloggers.Lock()
-		defer mloggers.Unlock()
-		mloggers.loggers[lo.module] = lgr
+		if lvl, ok := mloggers.levelOf(lo.module); ok {
+			lgr.option.Level, lgr.option.levelSet = lvl, true
+			lgr.leveldBackend.SetLevel(lvl, "")
+		}
+		if wl, ok := mloggers.loggers[lo.module]; ok {
+			wl.replace(lgr)
+		} else {
+			mloggers.loggers[lo.module] = lgr
+		}
+		mloggers.Unlock()
 	}
+	closeAll(replaced)
+	return lo.err
 }
 
 // M module log
@@ -186,9 +262,40 @@ func M(m string) *logging.Logger {
 	return mloggers.loggers[m].Logger
 }
 
+// levelOf returns the level set for module by environment, flags or SetMLevelRule, exact module
+// names take precedence over the first matching pattern, caller must hold the lock
+func (ml *moduleLoggers) levelOf(module string) (Level, bool) {
+	for _, l := range ml.levels {
+		if l.module == module {
+			return l.level, true
+		}
+	}
+	for _, l := range ml.levels {
+		if l.match(module) {
+			return l.level, true
+		}
+	}
+	return 0, false
+}
+
+// defaultOption returns a copy of default logger options to build a new default logger
+func defaultOption() LogOption {
+	opt := *defaultLgr.option
+	opt.files, opt.err = nil, nil
+	return opt
+}
+
+func newFormatter(format string) logging.Formatter {
+	if format == JSONFormat {
+		return logging.JSONFormatter
+	}
+	return logging.MustStringFormatter(format)
+}
+
 func defaultLogOption() LogOption {
 	return LogOption{
 		Level:          DEBUG,
+		levelSet:       true,
 		Format:         DebugColorFormat,
 		RotateType:     filelog.RotateNone,
 		CreateShortcut: false,
@@ -203,19 +310,48 @@ func init() {
 	}
 	dopt := defaultLogOption()
 	defaultLgr = createLogger(&dopt)
+	logging.AtExit(closeFiles)
+}
+
+// closeFiles close log files of default logger and module loggers
+func closeFiles() {
+	mloggers.RLock()
+	defer mloggers.RUnlock()
+	closeAll(defaultLgr.option.files)
+	for _, wl := range mloggers.loggers {
+		closeAll(wl.option.files)
+	}
+}
+
+func closeAll(files []io.WriteCloser) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// SetExitHandler set handler called by Fatal/Fatalf/MustNoErr instead of os.Exit, nil restore os.Exit,
+// the AtExit functions are not run before a handler which should call logging.Shutdown if it exits
+func SetExitHandler(h func(code int)) {
+	logging.SetExitHandler(h)
+}
+
+// AtExit register function run before Fatal/Fatalf/MustNoErr call os.Exit, log files are closed by default
+func AtExit(fn func()) {
+	logging.AtExit(fn)
 }
 
 func createLogger(opt *LogOption) *logWrapper {
 	if opt.Format == "" {
 		opt.Format = NormFormat
 	}
-	if opt.Level <= 0 {
+	// the zero Level is CRITICAL, it means unset unless set explicitly
+	if opt.Level < 0 || opt.Level == CRITICAL && !opt.levelSet {
 		opt.Level = INFO
 	}
 	lgr := logging.MustGetLogger(opt.module)
-	format := logging.MustStringFormatter(opt.Format)
+	format := newFormatter(opt.Format)
 
-	var leveldBackend logging.LeveledBackend
+	var leveldBackend, backend logging.LeveledBackend
 	if opt.LogFile != "" {
 		var backends []logging.LeveledBackend
 		// mkdir log dir
@@ -232,7 +368,7 @@ func createLogger(opt *LogOption) *logWrapper {
 		backendInfo := logging.NewLogBackend(infoLogFp, "", 0)
 		backendInfoFormatter := logging.NewBackendFormatter(backendInfo, format)
 		backendInfoLeveld := logging.AddModuleLevel(backendInfoFormatter)
-		backendInfoLeveld.SetLevel(opt.Level.loggingLevel(), "")
+		backendInfoLeveld.SetLevel(opt.Level, "")
 		leveldBackend = backendInfoLeveld
 		backends = append(backends, backendInfoLeveld)
 		opt.files = append(opt.files, infoLogFp)
@@ -257,19 +393,27 @@ func createLogger(opt *LogOption) *logWrapper {
 		for _, lb := range backends {
 			bl = append(bl, lb)
 		}
-		ml := logging.MultiLogger(bl...)
-		lgr.SetBackend(ml)
+		backend = logging.MultiLogger(bl...)
 	} else {
 		backend1 := logging.NewLogBackend(os.Stderr, "", 0)
 		backend1Formatter := logging.NewBackendFormatter(backend1, format)
 		backend1Leveled := logging.AddModuleLevel(backend1Formatter)
-		backend1Leveled.SetLevel(opt.Level.loggingLevel(), "")
+		backend1Leveled.SetLevel(opt.Level, "")
 		leveldBackend = backend1Leveled
-
-		lgr.SetBackend(backend1Leveled)
+		backend = backend1Leveled
 	}
+	sb := &swapBackend{backend: backend}
+	lgr.SetBackend(sb)
 	lgr.ExtraCalldepth++
-	return &logWrapper{Logger: lgr, option: opt, leveldBackend: leveldBackend}
+	return &logWrapper{Logger: lgr, option: opt, leveldBackend: leveldBackend, backend: sb}
+}
+
+// Enabled whether default logger writes log of level, use it to guard expensive debug computations
+func Enabled(lvl Level) bool {
+	if defaultLgr == nil {
+		return false
+	}
+	return defaultLgr.Enabled(lvl)
 }
 
 // Infof write leveled log
@@ -328,6 +472,14 @@ func Noticef(format string, args ...interface{}) {
 	defaultLgr.Noticef(format, args...)
 }
 
+// Tracef write leveled log
+func Tracef(format string, args ...interface{}) {
+	if defaultLgr == nil {
+		return
+	}
+	defaultLgr.Tracef(format, args...)
+}
+
 // Info write leveled log
 func Info(args ...interface{}) {
 	if defaultLgr == nil {
@@ -384,6 +536,14 @@ func Notice(args ...interface{}) {
 	defaultLgr.Noticef(strings.TrimSpace(strings.Repeat("%+v ", len(args))), args...)
 }
 
+// Trace write leveled log
+func Trace(args ...interface{}) {
+	if defaultLgr == nil {
+		return
+	}
+	defaultLgr.Tracef(strings.TrimSpace(strings.Repeat("%+v ", len(args))), args...)
+}
+
 // MustNoErr panic when err occur, should only used in test
 func MustNoErr(err error, desc ...string) {
 	if err != nil {
@@ -411,43 +571,52 @@ func MustNoErr(err error, desc ...string) {
 
 // GetLogLevel default logger level
 func GetLogLevel() string {
-	switch defaultLgr.option.Level {
-	case CRITICAL:
-		return "critical"
-	case ERROR:
-		return "error"
-	case WARNING:
-		return "warning"
-	case NOTICE:
-		return "notice"
-	case INFO:
-		return "info"
-	case DEBUG:
-		return "debug"
-	default:
-		return ""
-	}
+	return defaultLgr.leveldBackend.GetLevel("").Name()
 }
 
 // SetLogLevel default logger level
 func SetLogLevel(lvl string) error {
-	tlvl := parseLogLevel(lvl)
-	defaultLgr.option.Level = tlvl
-	defaultLgr.leveldBackend.SetLevel(tlvl.loggingLevel(), "")
+	tlvl, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	defaultLgr.option.Level, defaultLgr.option.levelSet = tlvl, true
+	defaultLgr.leveldBackend.SetLevel(tlvl, "")
 	return nil
 }
 
-// SetMLogLevel set module log level
+// SetMLogLevel set module log level, kept when the module is submitted again or a rule is set later
 func SetMLogLevel(module, lvl string) error {
-	mloggers.RLock()
-	defer mloggers.RUnlock()
+	mloggers.Lock()
+	defer mloggers.Unlock()
 	wl, ok := mloggers.loggers[module]
 	if !ok {
 		return errors.New("no such module " + module)
 	}
-	tlvl := parseLogLevel(lvl)
-	wl.option.Level = tlvl
-	wl.leveldBackend.SetLevel(tlvl.loggingLevel(), "")
+	tlvl, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	wl.option.Level, wl.option.levelSet = tlvl, true
+	wl.leveldBackend.SetLevel(tlvl, "")
+	// exact names take precedence over the rules set later
+	mloggers.remember(moduleLevel{module: module, match: func(m string) bool { return m == module }, level: tlvl})
+	return nil
+}
+
+// SetMLevelRule set level of module loggers matching pattern, including modules submitted later.
+// pattern is a glob like "http.*" or a regexp prefixed by "re:" like "re:^db\\.(pool|tx)$",
+// patterns are evaluated in order and exact module names take precedence
+func SetMLevelRule(pattern, lvl string) error {
+	tlvl, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	match, err := logging.CompileModulePattern(pattern)
+	if err != nil {
+		return err
+	}
+	setModuleLevels([]moduleLevel{{module: pattern, match: match, level: tlvl}})
 	return nil
 }
 
@@ -459,20 +628,5 @@ func GetMLogLevel(module string) string {
 	if !ok {
 		return ""
 	}
-	switch wl.option.Level {
-	case CRITICAL:
-		return "critical"
-	case ERROR:
-		return "error"
-	case WARNING:
-		return "warning"
-	case NOTICE:
-		return "notice"
-	case INFO:
-		return "info"
-	case DEBUG:
-		return "debug"
-	default:
-		return ""
-	}
+	return wl.leveldBackend.GetLevel("").Name()
 }
@@ -1,7 +1,12 @@
 package log
 
 import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
+
+	"github.com/qjpcpu/log/logging"
 )
 
 func TestLog(t *testing.T) {
@@ -16,3 +21,144 @@ func TestLog(t *testing.T) {
 	Notice("ok")
 	Critical("ok")
 }
+
+func TestSetLogLevel(t *testing.T) {
+	defer SetLogLevel(GetLogLevel())
+	if err := SetLogLevel("warn"); err != nil {
+		t.Fatal(err)
+	}
+	if GetLogLevel() != "warning" {
+		t.Errorf("unexpected level: %s", GetLogLevel())
+	}
+	if err := SetLogLevel("warnning"); err == nil {
+		t.Errorf("expected error for invalid level")
+	}
+	if GetLogLevel() != "warning" {
+		t.Errorf("level changed by invalid input: %s", GetLogLevel())
+	}
+}
+
+func TestMustNoErr(t *testing.T) {
+	logging.PanicOnFatal(true)
+	defer logging.PanicOnFatal(false)
+	defer func() {
+		if _, ok := recover().(*logging.FatalPanic); !ok {
+			t.Errorf("expected fatal panic")
+		}
+	}()
+	MustNoErr(errors.New("boom"), "test")
+}
+
+func TestSetMLogLevelConcurrent(t *testing.T) {
+	GetMBuilder("concurrent").SetLevel("info").Submit()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			M("concurrent").Debugf("debug %d", i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		SetMLogLevel("concurrent", "error")
+		GetMLogLevel("concurrent")
+	}
+	<-done
+	if GetMLogLevel("concurrent") != "error" {
+		t.Errorf("unexpected level: %s", GetMLogLevel("concurrent"))
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	defer SetLogLevel(GetLogLevel())
+	SetLogLevel("info")
+	if !Enabled(INFO) || Enabled(DEBUG) {
+		t.Errorf("unexpected enabled levels at info")
+	}
+}
+
+func TestSetMLevelRule(t *testing.T) {
+	GetMBuilder("rule.db.pool").SetLevel("info").Submit()
+	if err := SetMLevelRule(`re:^rule\.db\.`, "error"); err != nil {
+		t.Fatal(err)
+	}
+	if GetMLogLevel("rule.db.pool") != "error" {
+		t.Errorf("rule not applied: %s", GetMLogLevel("rule.db.pool"))
+	}
+	GetMBuilder("rule.db.tx").Submit()
+	if GetMLogLevel("rule.db.tx") != "error" {
+		t.Errorf("rule not applied to new module: %s", GetMLogLevel("rule.db.tx"))
+	}
+	if err := SetMLevelRule("re:(", "error"); err == nil {
+		t.Errorf("expected error for invalid pattern")
+	}
+}
+
+func TestSetMLogLevelBeforeRule(t *testing.T) {
+	GetMBuilder("rv.db").Submit()
+	GetMBuilder("rv.http").Submit()
+	if err := SetMLogLevel("rv.db", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMLevelRule("rv.*", "error"); err != nil {
+		t.Fatal(err)
+	}
+	if GetMLogLevel("rv.db") != "debug" || GetMLogLevel("rv.http") != "error" {
+		t.Errorf("unexpected levels: %s %s", GetMLogLevel("rv.db"), GetMLogLevel("rv.http"))
+	}
+}
+
+func TestZeroLevelOption(t *testing.T) {
+	opt := LogOption{module: "zerolevel"}
+	opt.Submit()
+	if lvl := GetMLogLevel("zerolevel"); lvl != "info" {
+		t.Errorf("unset level: expected info, got %s", lvl)
+	}
+	GetMBuilder("critlevel").SetTypedLevel(CRITICAL).Submit()
+	if lvl := GetMLogLevel("critlevel"); lvl != "critical" {
+		t.Errorf("expected critical, got %s", lvl)
+	}
+	GetMBuilder("critlevel").SetLevel("crit").Submit()
+	if lvl := GetMLogLevel("critlevel"); lvl != "critical" {
+		t.Errorf("expected critical, got %s", lvl)
+	}
+}
+
+func TestSubmitKeepsCachedLoggers(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.log"), filepath.Join(dir, "second.log")
+	if err := GetMBuilder("rvdb").SetFile(first).SetFormat("%{message}").Submit(); err != nil {
+		t.Fatal(err)
+	}
+	cached := M("rvdb")
+	var errs []error
+	cached.SetErrorHandler(func(err error, rec *logging.Record) { errs = append(errs, err) })
+	if err := GetMBuilder("rvdb").SetFile(second).SetFormat("%{message}").Submit(); err != nil {
+		t.Fatal(err)
+	}
+	cached.Infof("after submit")
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	data, _ := ioutil.ReadFile(second)
+	if string(data) != "after submit\n" {
+		t.Errorf("record not written to the new file: %q", data)
+	}
+	GetMBuilder("rvdb").Submit()
+}
+
+func TestLogAfterNonExitingFatal(t *testing.T) {
+	defer GetBuilder().Submit()
+	defer SetExitHandler(nil)
+	file := filepath.Join(t.TempDir(), "a.log")
+	if err := GetBuilder().SetFile(file).SetFormat("%{message}").Submit(); err != nil {
+		t.Fatal(err)
+	}
+	SetExitHandler(func(int) {})
+	Fatalf("first")
+	Infof("after fatal")
+	Fatalf("second")
+	data, _ := ioutil.ReadFile(file)
+	if string(data) != "first\nafter fatal\nsecond\n" {
+		t.Errorf("unexpected log file content %q", data)
+	}
+}
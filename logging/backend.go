@@ -33,6 +33,12 @@ func SetLevel(level Level, module string) {
 	defaultBackend.SetLevel(level, module)
 }
 
+// SetLevelRule sets the logging level for all modules matching pattern, see
+// CompileModulePattern.
+func SetLevelRule(pattern string, level Level) error {
+	return defaultBackend.SetLevelRule(pattern, level)
+}
+
 // GetLevel returns the logging level for the specified module.
 func GetLevel(module string) Level {
 	return defaultBackend.GetLevel(module)
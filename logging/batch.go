@@ -0,0 +1,299 @@
+package logging
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchOptions configure how backends sending records in batches, like
+// HTTPBackend, group and retry them.
+type BatchOptions struct {
+	// MaxRecords and MaxBytes limit the size of a batch. They default to
+	// 100 records and 1MB.
+	MaxRecords int
+	MaxBytes   int
+	// MaxLatency is the longest time a record waits for its batch to be
+	// sent. It defaults to 1 second.
+	MaxLatency time.Duration
+	// BufferSize is the number of records waiting to be sent, records are
+	// dropped once it is full. It defaults to 10000.
+	BufferSize int
+	// MaxRetries is the number of times a batch is retried on temporary
+	// failures before it is dropped. It defaults to 5, a negative value
+	// disables retries.
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the exponential backoff between
+	// retries, the time the server tells to wait is also capped by
+	// MaxBackoff. They default to 100ms and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// BatchStats counts the records handled by a batching backend.
+type BatchStats struct {
+	// Sent is the number of records sent successfully.
+	Sent uint64
+	// Dropped is the number of records dropped because the buffer was full.
+	Dropped uint64
+	// Failed is the number of records dropped because their batch could not
+	// be sent.
+	Failed uint64
+	// Retries is the number of times a batch was sent again.
+	Retries uint64
+}
+
+// RetryableError is returned by a batch sender for temporary failures. After
+// is the time to wait before retrying, if known.
+type RetryableError struct {
+	Err   error
+	After time.Duration
+}
+
+// Error implements the error interface.
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// batchEntry is a record waiting to be sent, with its data as encoded by the
+// backend and the size it counts for in MaxBytes.
+type batchEntry struct {
+	rec  *Record
+	data []byte
+	size int
+}
+
+// batcher groups entries and passes them to send from its own goroutine, in
+// the order they were added.
+type batcher struct {
+	opts BatchOptions
+	send func([]batchEntry) error
+
+	in    chan batchEntry
+	flush chan chan struct{}
+	stop  chan struct{} // closed by Close to cut the retry waits short
+	done  chan struct{}
+
+	mu     sync.RWMutex // guards closed and in against close
+	closed bool
+
+	stats BatchStats
+}
+
+func newBatcher(opts BatchOptions, send func([]batchEntry) error) *batcher {
+	if opts.MaxRecords <= 0 {
+		opts.MaxRecords = 100
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 1 << 20
+	}
+	if opts.MaxLatency <= 0 {
+		opts.MaxLatency = time.Second
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 10000
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = 5
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	b := &batcher{
+		opts:  opts,
+		send:  send,
+		in:    make(chan batchEntry, opts.BufferSize),
+		flush: make(chan chan struct{}),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add queues an entry, or drops it if the buffer is full.
+func (b *batcher) add(rec *Record, data []byte) error {
+	return b.addSized(rec, data, len(data))
+}
+
+// addSized is the same as add for backends sending more than data, size
+// being the bytes sent for the entry.
+func (b *batcher) addSized(rec *Record, data []byte, size int) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return errClosed
+	}
+	select {
+	case b.in <- batchEntry{rec, data, size}:
+		return nil
+	default:
+		atomic.AddUint64(&b.stats.Dropped, 1)
+		return ErrQueueFull
+	}
+}
+
+// Flush sends the queued entries and waits until they are sent.
+func (b *batcher) Flush() {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return
+	}
+	ch := make(chan struct{})
+	b.flush <- ch
+	b.mu.RUnlock()
+	<-ch
+}
+
+// Close sends the queued entries and stops the batcher. Failed batches are
+// retried from then on without waiting.
+func (b *batcher) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+		close(b.in)
+	}
+	b.mu.Unlock()
+	<-b.done
+}
+
+// Stats returns the counters of the batcher.
+func (b *batcher) Stats() BatchStats {
+	return BatchStats{
+		Sent:    atomic.LoadUint64(&b.stats.Sent),
+		Dropped: atomic.LoadUint64(&b.stats.Dropped),
+		Failed:  atomic.LoadUint64(&b.stats.Failed),
+		Retries: atomic.LoadUint64(&b.stats.Retries),
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+
+	var batch []batchEntry
+	var size int
+	timer := time.NewTimer(b.opts.MaxLatency)
+	timer.Stop()
+	send := func() {
+		timer.Stop()
+		if len(batch) > 0 {
+			b.sendWithRetry(batch)
+		}
+		batch, size = nil, 0
+	}
+	push := func(e batchEntry) {
+		if len(batch) > 0 && size+e.size > b.opts.MaxBytes {
+			send()
+		}
+		if len(batch) == 0 {
+			timer.Reset(b.opts.MaxLatency)
+		}
+		batch = append(batch, e)
+		size += e.size
+		if len(batch) >= b.opts.MaxRecords || size >= b.opts.MaxBytes {
+			send()
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-b.in:
+			if !ok {
+				send()
+				return
+			}
+			push(e)
+		case <-timer.C:
+			send()
+		case ch := <-b.flush:
+			// take the entries queued before the flush
+			for n := len(b.in); n > 0; n-- {
+				push(<-b.in)
+			}
+			send()
+			close(ch)
+		}
+	}
+}
+
+// partialFailure is returned by a batch sender when only some entries of the
+// batch were sent. The entries to retry, because of retryErr, are sent again
+// while failed ones, because of err reported with errRec, are dropped.
+type partialFailure struct {
+	retry    []batchEntry
+	retryErr error
+	failed   int
+	err      error
+	errRec   *Record
+}
+
+func (e *partialFailure) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return e.retryErr.Error()
+}
+
+// sendWithRetry sends batch, retrying temporary failures with backoff.
+func (b *batcher) sendWithRetry(batch []batchEntry) {
+	backoff := b.opts.MinBackoff
+	for attempt := 0; ; attempt++ {
+		err := b.send(batch)
+		if err == nil {
+			atomic.AddUint64(&b.stats.Sent, uint64(len(batch)))
+			return
+		}
+
+		var partial *partialFailure
+		if errors.As(err, &partial) {
+			atomic.AddUint64(&b.stats.Sent, uint64(len(batch)-len(partial.retry)-partial.failed))
+			if partial.failed > 0 {
+				atomic.AddUint64(&b.stats.Failed, uint64(partial.failed))
+				reportError(partial.err, partial.errRec)
+			}
+			if len(partial.retry) == 0 {
+				return
+			}
+			batch = partial.retry
+			err = &RetryableError{Err: partial.retryErr}
+		}
+
+		var retry *RetryableError
+		if !errors.As(err, &retry) || attempt >= b.opts.MaxRetries {
+			atomic.AddUint64(&b.stats.Failed, uint64(len(batch)))
+			reportError(err, batch[0].rec)
+			return
+		}
+
+		wait := backoff
+		if retry.After > 0 {
+			wait = retry.After
+		}
+		if wait > b.opts.MaxBackoff {
+			wait = b.opts.MaxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-b.stop:
+			timer.Stop()
+		}
+		if backoff *= 2; backoff > b.opts.MaxBackoff {
+			backoff = b.opts.MaxBackoff
+		}
+		atomic.AddUint64(&b.stats.Retries, 1)
+	}
+}
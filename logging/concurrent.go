@@ -0,0 +1,268 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultQueueSize is the default number of records queued per backend by a
+// ConcurrentMultiLogger.
+const defaultQueueSize = 1024
+
+var (
+	// ErrQueueFull is reported when a record is dropped because the queue of
+	// a backend is full.
+	ErrQueueFull = errors.New("logging: backend queue full")
+	// ErrWriteTimeout is reported when a backend did not write a record
+	// within the write timeout.
+	ErrWriteTimeout = errors.New("logging: backend write timed out")
+)
+
+// ConcurrentOptions configure a ConcurrentMultiLogger.
+type ConcurrentOptions struct {
+	// QueueSize is the number of records queued per backend. It defaults
+	// to 1024.
+	QueueSize int
+	// Timeout is the time a backend is given to write a record. A write
+	// taking longer is reported as ErrWriteTimeout and abandoned, the
+	// records queued for the backend until it returns are dropped. Zero
+	// disables the timeout, a hung backend then also blocks Close.
+	Timeout time.Duration
+	// Block makes Log wait for room in a full queue instead of dropping
+	// the record.
+	Block bool
+	// ErrorHandler is called with the errors of the backends, which are
+	// written away from the logger. It defaults to the global handler, see
+	// SetErrorHandler.
+	ErrorHandler ErrorHandler
+}
+
+// BackendHealth is the state of one backend of a ConcurrentMultiLogger.
+type BackendHealth struct {
+	// Healthy is false if the last write failed, timed out or is still
+	// pending past the timeout.
+	Healthy bool
+	// LastError is the error of the last failed write and LastErrorTime
+	// when it happened.
+	LastError     error
+	LastErrorTime time.Time
+	// Queued is the number of records waiting to be written.
+	Queued int
+	// Written and Dropped count the records written and dropped so far.
+	Written uint64
+	Dropped uint64
+}
+
+// ConcurrentMultiLogger is a multiLogger where each backend has its own queue
+// and worker, so a slow or hung backend does not block the others nor the
+// caller. Records are written to each backend in the order they were logged.
+type ConcurrentMultiLogger struct {
+	*multiLogger
+
+	opts    ConcurrentOptions
+	workers []*backendWorker
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex // guards closed and the queues against Close
+	closed bool
+	// done is closed first by Close, to release the callers blocked on a
+	// full queue which hold mu.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// backendWorker writes the records queued for one backend.
+type backendWorker struct {
+	backend LeveledBackend
+	queue   chan *Record
+
+	written uint64
+	dropped uint64
+
+	// stuck receives the result of an abandoned write, only used by the
+	// worker.
+	stuck chan error
+
+	mu            sync.Mutex
+	healthy       bool
+	lastError     error
+	lastErrorTime time.Time
+}
+
+// NewConcurrentMultiLogger creates a ConcurrentMultiLogger writing to
+// backends. Close should be called to write the queued records before the
+// program exits, eg. by registering it with AtExit.
+func NewConcurrentMultiLogger(opts ConcurrentOptions, backends ...Backend) *ConcurrentMultiLogger {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	m := &ConcurrentMultiLogger{
+		multiLogger: MultiLogger(backends...).(*multiLogger),
+		opts:        opts,
+		done:        make(chan struct{}),
+	}
+	for _, backend := range m.backends {
+		w := &backendWorker{
+			backend: backend,
+			queue:   make(chan *Record, opts.QueueSize),
+			healthy: true,
+		}
+		m.workers = append(m.workers, w)
+		m.wg.Add(1)
+		go m.run(w)
+	}
+	return m
+}
+
+// Log queues the record for all backends enabled for it. Errors of the
+// backends are reported to the error handler, only records dropped because
+// of a full queue are reported by the returned error.
+func (m *ConcurrentMultiLogger) Log(level Level, calldepth int, rec *Record) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return errClosed
+	}
+
+	// The records are formatted in the workers, away from the logging call
+	// and after the arguments may have changed.
+	rec.captureCaller(calldepth + 1)
+	rec.Message()
+
+	var errs MultiError
+	for i, w := range m.workers {
+		if !w.backend.IsEnabledFor(level, rec.Module) {
+			continue
+		}
+		// Shallow copy of the record for the formatted cache on Record.
+		r2 := *rec
+		if m.opts.Block {
+			select {
+			case w.queue <- &r2:
+			case <-m.done:
+				errs = append(errs, fmt.Errorf("backend %d: %w", i, errClosed))
+			}
+			continue
+		}
+		select {
+		case w.queue <- &r2:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+			errs = append(errs, fmt.Errorf("backend %d: %w", i, ErrQueueFull))
+		}
+	}
+	return errs.errorOrNil()
+}
+
+// Health returns the state of the backends, in the order they were given.
+func (m *ConcurrentMultiLogger) Health() []BackendHealth {
+	health := make([]BackendHealth, len(m.workers))
+	for i, w := range m.workers {
+		w.mu.Lock()
+		health[i] = BackendHealth{
+			Healthy:       w.healthy,
+			LastError:     w.lastError,
+			LastErrorTime: w.lastErrorTime,
+			Queued:        len(w.queue),
+			Written:       atomic.LoadUint64(&w.written),
+			Dropped:       atomic.LoadUint64(&w.dropped),
+		}
+		w.mu.Unlock()
+	}
+	return health
+}
+
+// Close stops accepting records and waits until the queued records have been
+// written, or dropped by backends past the timeout. Callers blocked on a full
+// queue are released with an error.
+func (m *ConcurrentMultiLogger) Close() {
+	m.closeOnce.Do(func() { close(m.done) })
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		for _, w := range m.workers {
+			close(w.queue)
+		}
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+func (m *ConcurrentMultiLogger) run(w *backendWorker) {
+	defer m.wg.Done()
+	for rec := range w.queue {
+		if err := m.write(w, rec); err != nil {
+			continue
+		}
+		atomic.AddUint64(&w.written, 1)
+		w.mu.Lock()
+		w.healthy = true
+		w.mu.Unlock()
+	}
+}
+
+// write logs rec to the backend of w and reports its error. A write taking
+// longer than the timeout is reported once as ErrWriteTimeout, marking the
+// backend unhealthy, and abandoned. Records are dropped until it returns, to
+// keep them in order and the worker from piling up hung writes.
+func (m *ConcurrentMultiLogger) write(w *backendWorker, rec *Record) error {
+	if w.stuck != nil {
+		select {
+		case <-w.stuck:
+			w.stuck = nil
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+			return ErrWriteTimeout
+		}
+	}
+	if m.opts.Timeout <= 0 {
+		err := w.backend.Log(rec.Level, 0, rec)
+		if err != nil {
+			w.fail(err)
+			m.report(err, rec)
+		}
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := w.backend.Log(rec.Level, 0, rec)
+		if err != nil {
+			// kept in the health, even once the write is abandoned
+			w.fail(err)
+		}
+		done <- err
+	}()
+	timer := time.NewTimer(m.opts.Timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			m.report(err, rec)
+		}
+		return err
+	case <-timer.C:
+		w.fail(ErrWriteTimeout)
+		m.report(ErrWriteTimeout, rec)
+		w.stuck = done
+		return ErrWriteTimeout
+	}
+}
+
+func (m *ConcurrentMultiLogger) report(err error, rec *Record) {
+	if m.opts.ErrorHandler != nil {
+		m.opts.ErrorHandler(err, rec)
+		return
+	}
+	reportError(err, rec)
+}
+
+func (w *backendWorker) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.healthy = false
+	w.lastError = err
+	w.lastErrorTime = timeNow()
+}
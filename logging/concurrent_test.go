@@ -0,0 +1,276 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingBackend blocks every write until release is closed.
+type blockingBackend struct {
+	release chan struct{}
+}
+
+func (b *blockingBackend) Log(level Level, calldepth int, rec *Record) error {
+	<-b.release
+	return nil
+}
+
+// syncBackend collects the formatted records, safe for concurrent use.
+type syncBackend struct {
+	mu      sync.Mutex
+	records []string
+	err     error
+}
+
+func (b *syncBackend) Log(level Level, calldepth int, rec *Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.records = append(b.records, rec.Formatted(calldepth+1))
+	return nil
+}
+
+func (b *syncBackend) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.records...)
+}
+
+// waitFor waits until cond is true.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrentMultiLoggerOrder(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	b1, b2 := &syncBackend{}, &syncBackend{}
+	multi := NewConcurrentMultiLogger(ConcurrentOptions{Block: true}, b1, b2)
+	log := MustGetLogger("test")
+	log.SetBackend(multi)
+
+	var expected []string
+	for i := 0; i < 100; i++ {
+		log.Infof("record %d", i)
+		expected = append(expected, fmt.Sprintf("record %d", i))
+	}
+	multi.Close()
+
+	for i, b := range []*syncBackend{b1, b2} {
+		if got := strings.Join(b.lines(), ","); got != strings.Join(expected, ",") {
+			t.Errorf("backend %d: unexpected records %s", i, got)
+		}
+	}
+	for i, h := range multi.Health() {
+		if !h.Healthy || h.Written != 100 || h.Dropped != 0 || h.Queued != 0 {
+			t.Errorf("backend %d: unexpected health %+v", i, h)
+		}
+	}
+}
+
+func TestConcurrentMultiLoggerHungBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	hung := &blockingBackend{release: make(chan struct{})}
+	defer close(hung.release)
+	fast := &syncBackend{}
+	var mu sync.Mutex
+	var reported []error
+	multi := NewConcurrentMultiLogger(ConcurrentOptions{
+		QueueSize: 2,
+		Timeout:   200 * time.Millisecond,
+		ErrorHandler: func(err error, rec *Record) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		},
+	}, hung, fast)
+	log := MustGetLogger("test")
+	log.SetBackend(multi)
+	var dropped []error
+	log.SetErrorHandler(func(err error, rec *Record) { dropped = append(dropped, err) })
+
+	// The first record is taken by the worker, two are queued and the
+	// fourth one is dropped, without blocking the caller.
+	for i := 0; i < 4; i++ {
+		log.Info("record")
+		waitFor(t, func() bool { return len(fast.lines()) == i+1 })
+		if i == 0 {
+			waitFor(t, func() bool { return multi.Health()[0].Queued == 0 })
+		}
+	}
+	if len(dropped) != 1 || !errors.Is(dropped[0], ErrQueueFull) {
+		t.Errorf("expected dropped records, got %v", dropped)
+	}
+
+	// past the timeout, the queued records are dropped while the write hangs
+	waitFor(t, func() bool { return multi.Health()[0].Dropped == 3 })
+	health := multi.Health()
+	if health[0].Healthy || health[0].LastError != ErrWriteTimeout || health[0].Queued != 0 {
+		t.Errorf("unexpected health of hung backend %+v", health[0])
+	}
+	mu.Lock()
+	if len(reported) != 1 || reported[0] != ErrWriteTimeout {
+		t.Errorf("unexpected reported errors %v", reported)
+	}
+	mu.Unlock()
+	if !health[1].Healthy || len(fast.lines()) != 4 {
+		t.Errorf("unexpected health %+v of fast backend with records %q", health[1], fast.lines())
+	}
+}
+
+func TestConcurrentMultiLoggerCloseHung(t *testing.T) {
+	hung := &blockingBackend{release: make(chan struct{})}
+	defer close(hung.release)
+	multi := NewConcurrentMultiLogger(ConcurrentOptions{Timeout: 10 * time.Millisecond}, hung)
+	for i := 0; i < 3; i++ {
+		multi.Log(INFO, 0, &Record{Level: INFO})
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		multi.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked by a hung backend")
+	}
+	if h := multi.Health()[0]; h.Dropped != 2 || h.Written != 0 {
+		t.Errorf("unexpected health %+v", h)
+	}
+}
+
+func TestConcurrentMultiLoggerErrors(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	errDisk := errors.New("disk full")
+	failing := &syncBackend{err: errDisk}
+	reported := make(chan error, 1)
+	multi := NewConcurrentMultiLogger(ConcurrentOptions{
+		ErrorHandler: func(err error, rec *Record) { reported <- err },
+	}, failing)
+	log := MustGetLogger("test")
+	log.SetBackend(multi)
+	log.Info("record")
+	multi.Close()
+
+	if err := <-reported; err != errDisk {
+		t.Errorf("unexpected error %v", err)
+	}
+	if h := multi.Health()[0]; h.Healthy || h.LastError != errDisk || h.Written != 0 {
+		t.Errorf("unexpected health %+v", h)
+	}
+	if err := multi.Log(INFO, 0, &Record{Level: INFO}); err == nil {
+		t.Errorf("expected error logging to closed backend")
+	}
+}
+
+func TestConcurrentMultiLoggerCaller(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	buf := &bytes.Buffer{}
+	multi := NewConcurrentMultiLogger(ConcurrentOptions{},
+		NewBackendFormatter(NewLogBackend(buf, "", 0), MustStringFormatter("%{shortfile} %{level} %{message}")))
+	multi.SetLevel(INFO, "")
+	log := MustGetLogger("test")
+	log.SetBackend(multi)
+
+	args := []interface{}{"before"}
+	log.Debug("hidden")
+	log.Info(args...)
+	args[0] = "after"
+	multi.Close()
+
+	if buf.String() != "concurrent_test.go:195 INFO before\n" {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestConcurrentMultiLoggerBlockClose(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	hung := &blockingBackend{release: make(chan struct{})}
+	multi := NewConcurrentMultiLogger(ConcurrentOptions{QueueSize: 1, Block: true}, hung)
+
+	// the first record is taken by the worker and the second one queued,
+	// the third one blocks until Close
+	multi.Log(INFO, 0, &Record{Level: INFO})
+	waitFor(t, func() bool { return multi.Health()[0].Queued == 0 })
+	multi.Log(INFO, 0, &Record{Level: INFO})
+	blocked := make(chan error, 1)
+	go func() { blocked <- multi.Log(INFO, 0, &Record{Level: INFO}) }()
+
+	closed := make(chan struct{})
+	go func() {
+		multi.Close()
+		close(closed)
+	}()
+	select {
+	case err := <-blocked:
+		if !errors.Is(err, errClosed) {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked caller not released by Close")
+	}
+	close(hung.release)
+	<-closed
+	if h := multi.Health()[0]; h.Written != 2 {
+		t.Errorf("unexpected health %+v", h)
+	}
+}
+
+// slowFailingBackend fails each write after delay.
+type slowFailingBackend struct {
+	delay time.Duration
+	err   error
+}
+
+func (b *slowFailingBackend) Log(level Level, calldepth int, rec *Record) error {
+	time.Sleep(b.delay)
+	return b.err
+}
+
+func TestConcurrentMultiLoggerTimeoutReportedOnce(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	errDisk := errors.New("disk full")
+	var mu sync.Mutex
+	var reported []error
+	multi := NewConcurrentMultiLogger(ConcurrentOptions{
+		Timeout: time.Millisecond,
+		ErrorHandler: func(err error, rec *Record) {
+			mu.Lock()
+			reported = append(reported, err)
+			mu.Unlock()
+		},
+	}, &slowFailingBackend{delay: 20 * time.Millisecond, err: errDisk})
+	multi.Log(INFO, 0, &Record{Level: INFO})
+	multi.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || reported[0] != ErrWriteTimeout {
+		t.Errorf("unexpected reported errors %v", reported)
+	}
+	// the error of the abandoned write is kept in the health
+	waitFor(t, func() bool { return multi.Health()[0].LastError == errDisk })
+	if h := multi.Health()[0]; h.Healthy {
+		t.Errorf("unexpected health %+v", h)
+	}
+}
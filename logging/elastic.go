@@ -0,0 +1,172 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ElasticOptions configure an ElasticBackend.
+type ElasticOptions struct {
+	// HTTPOptions configure the requests and batches. The Encoding and the
+	// Formatter are ignored, records are indexed as JSON documents.
+	HTTPOptions
+	// IndexPrefix and IndexDateLayout name the index of a record after its
+	// time in UTC, eg. "app-logs-2026.10.17". They default to "logs-" and
+	// "2006.01.02".
+	IndexPrefix     string
+	IndexDateLayout string
+	// APIKey sets API key authentication.
+	APIKey string
+}
+
+// ElasticBackend indexes records in batches into Elasticsearch or OpenSearch
+// using the bulk API. Documents rejected with 429 or 5xx are retried, other
+// rejected documents are dropped.
+type ElasticBackend struct {
+	url   string
+	opts  ElasticOptions
+	batch *batcher
+}
+
+// elasticDocument is the document indexed for a record.
+type elasticDocument struct {
+	Timestamp string `json:"@timestamp"`
+	Level     string `json:"level"`
+	Module    string `json:"module,omitempty"`
+	Message   string `json:"message"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Function  string `json:"function,omitempty"`
+	Fields    Fields `json:"fields,omitempty"`
+}
+
+// elasticBulkResponse is the response of the bulk API.
+type elasticBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// NewElasticBackend creates an ElasticBackend indexing into the cluster at url,
+// eg. "http://localhost:9200". Close should be called to send the pending
+// records before the program exits.
+func NewElasticBackend(url string, opts ElasticOptions) *ElasticBackend {
+	opts.setDefaults()
+	if opts.IndexPrefix == "" {
+		opts.IndexPrefix = "logs-"
+	}
+	if opts.IndexDateLayout == "" {
+		opts.IndexDateLayout = "2006.01.02"
+	}
+	b := &ElasticBackend{
+		url:  strings.TrimRight(url, "/") + "/_bulk",
+		opts: opts,
+	}
+	b.batch = newBatcher(opts.BatchOptions, b.send)
+	return b
+}
+
+// Log implements the Backend interface.
+func (b *ElasticBackend) Log(level Level, calldepth int, rec *Record) error {
+	doc := &elasticDocument{
+		Timestamp: rec.Time.UTC().Format(time.RFC3339Nano),
+		Level:     rec.Level.Name(),
+		Module:    rec.Module,
+		Message:   rec.Message(),
+		Fields:    rec.Fields,
+	}
+	if frame, ok := rec.Caller(calldepth + 1); ok {
+		doc.File, doc.Line, doc.Function = frame.File, frame.Line, frame.Function
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return b.batch.add(rec, data)
+}
+
+// Flush sends the pending records and waits until they are sent.
+func (b *ElasticBackend) Flush() {
+	b.batch.Flush()
+}
+
+// Close sends the pending records and stops the backend.
+func (b *ElasticBackend) Close() {
+	b.batch.Close()
+}
+
+// Stats returns the number of records sent and dropped.
+func (b *ElasticBackend) Stats() BatchStats {
+	return b.batch.Stats()
+}
+
+// Index returns the name of the index of rec.
+func (b *ElasticBackend) Index(rec *Record) string {
+	return b.opts.IndexPrefix + rec.Time.UTC().Format(b.opts.IndexDateLayout)
+}
+
+func (b *ElasticBackend) send(batch []batchEntry) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range batch {
+		action := map[string]map[string]string{"create": {"_index": b.Index(e.rec)}}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		body.Write(e.data)
+		body.WriteByte('\n')
+	}
+
+	req, err := b.opts.newRequest(b.url, "application/x-ndjson", &body)
+	if err != nil {
+		return err
+	}
+	if b.opts.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+b.opts.APIKey)
+	}
+	data, err := doHTTP(b.opts.Client, req)
+	if err != nil {
+		return err
+	}
+
+	var resp elasticBulkResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("logging: invalid bulk response: %s", err)
+	}
+	if !resp.Errors {
+		return nil
+	}
+	if len(resp.Items) != len(batch) {
+		return fmt.Errorf("logging: bulk response has %d items for %d documents", len(resp.Items), len(batch))
+	}
+
+	partial := &partialFailure{}
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status < 300 {
+				continue
+			}
+			err := fmt.Errorf("logging: bulk indexing failed with status %d: %s", result.Status, result.Error)
+			if result.Status == 429 || result.Status >= 500 {
+				partial.retry = append(partial.retry, batch[i])
+				if partial.retryErr == nil {
+					partial.retryErr = err
+				}
+			} else {
+				partial.failed++
+				if partial.err == nil {
+					partial.err, partial.errRec = err, batch[i].rec
+				}
+			}
+		}
+	}
+	if partial.err == nil && partial.retryErr == nil {
+		return nil
+	}
+	return partial
+}
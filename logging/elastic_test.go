@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkStandIn is a stand-in bulk API rejecting the documents whose message
+// is a key of reject with the given status, once for 429.
+type bulkStandIn struct {
+	mu     sync.Mutex
+	docs   []map[string]interface{}
+	index  []string
+	reject map[string]int
+}
+
+func (s *bulkStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []string
+	hasErrors := false
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil || action["create"] == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var doc map[string]interface{}
+		if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &doc) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		status := 201
+		if st, ok := s.reject[doc["message"].(string)]; ok {
+			status = st
+			if st == 429 {
+				delete(s.reject, doc["message"].(string))
+			}
+		}
+		if status == 201 {
+			s.docs = append(s.docs, doc)
+			s.index = append(s.index, action["create"]["_index"])
+			items = append(items, `{"create":{"status":201}}`)
+		} else {
+			hasErrors = true
+			items = append(items, fmt.Sprintf(`{"create":{"status":%d,"error":{"type":"rejected"}}}`, status))
+		}
+	}
+	fmt.Fprintf(w, `{"took":1,"errors":%t,"items":[%s]}`, hasErrors, strings.Join(items, ","))
+}
+
+func TestElasticBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2026, 10, 17, 23, 30, 0, 0, time.FixedZone("", -3600))
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	standIn := &bulkStandIn{reject: map[string]int{"throttled": 429, "invalid": 400}}
+	ts := httptest.NewServer(standIn)
+	defer ts.Close()
+
+	var reported []error
+	var reportedRecs []*Record
+	SetErrorHandler(func(err error, rec *Record) {
+		reported = append(reported, err)
+		reportedRecs = append(reportedRecs, rec)
+	})
+	defer SetErrorHandler(RateLimitedErrorHandler(os.Stderr, defaultErrorInterval))
+
+	backend := NewElasticBackend(ts.URL, ElasticOptions{
+		HTTPOptions: HTTPOptions{
+			BatchOptions: BatchOptions{MinBackoff: time.Millisecond},
+		},
+		IndexPrefix: "app-logs-",
+		APIKey:      "key",
+	})
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+	log.WithFields(Fields{"rows": 3}).Info("query")
+	log.Warning("throttled")
+	log.Error("invalid")
+	backend.Close()
+
+	if len(standIn.docs) != 2 {
+		t.Fatalf("unexpected documents %v", standIn.docs)
+	}
+	doc := standIn.docs[0]
+	expected := map[string]interface{}{
+		"@timestamp": "2026-10-18T00:30:00Z",
+		"level":      "info",
+		"module":     "db",
+		"message":    "query",
+		"function":   "github.com/qjpcpu/log/logging.TestElasticBackend",
+	}
+	for k, v := range expected {
+		if doc[k] != v {
+			t.Errorf("unexpected %s: %v != %v", k, doc[k], v)
+		}
+	}
+	if file, _ := doc["file"].(string); filepath.Base(file) != "elastic_test.go" {
+		t.Errorf("unexpected file %v", doc["file"])
+	}
+	if fields, _ := doc["fields"].(map[string]interface{}); fields["rows"] != float64(3) {
+		t.Errorf("unexpected fields %v", doc["fields"])
+	}
+	if standIn.docs[1]["message"] != "throttled" {
+		t.Errorf("throttled document not retried: %v", standIn.docs[1])
+	}
+	if standIn.index[0] != "app-logs-2026.10.18" {
+		t.Errorf("unexpected index %q", standIn.index[0])
+	}
+
+	if stats := backend.Stats(); stats.Sent != 2 || stats.Failed != 1 || stats.Retries != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "status 400") {
+		t.Errorf("unexpected errors %v", reported)
+	} else if msg := reportedRecs[0].Message(); msg != "invalid" {
+		t.Errorf("error reported with record %q", msg)
+	}
+}
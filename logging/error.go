@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorHandler is called with the error returned by the backend of a logger
+// and the record which failed to be logged.
+type ErrorHandler func(err error, rec *Record)
+
+// defaultErrorInterval is the minimum time between two errors reported by the
+// default error handler.
+const defaultErrorInterval = 10 * time.Second
+
+var errorHandler = struct {
+	sync.RWMutex
+	h ErrorHandler
+}{h: RateLimitedErrorHandler(os.Stderr, defaultErrorInterval)}
+
+// SetErrorHandler replaces the handler used by all loggers without a handler
+// of their own. A nil handler discards the errors. By default, errors are
+// reported to stderr at most once every 10 seconds.
+func SetErrorHandler(h ErrorHandler) {
+	errorHandler.Lock()
+	defer errorHandler.Unlock()
+	errorHandler.h = h
+}
+
+// SetErrorHandler overrides the error handler for this logger, see
+// SetErrorHandler.
+func (l *Logger) SetErrorHandler(h ErrorHandler) {
+	l.errorHandler = h
+}
+
+func (l *Logger) handleError(err error, rec *Record) {
+	if l.errorHandler != nil {
+		l.errorHandler(err, rec)
+		return
+	}
+	reportError(err, rec)
+}
+
+// reportError passes err to the global error handler.
+func reportError(err error, rec *Record) {
+	errorHandler.RLock()
+	h := errorHandler.h
+	errorHandler.RUnlock()
+	if h != nil {
+		h(err, rec)
+	}
+}
+
+// RateLimitedErrorHandler returns an ErrorHandler writing at most one error
+// to w per interval. The number of errors dropped in between is reported
+// along with the next error written.
+func RateLimitedErrorHandler(w io.Writer, interval time.Duration) ErrorHandler {
+	var mu sync.Mutex
+	var last time.Time
+	var dropped int
+	return func(err error, rec *Record) {
+		mu.Lock()
+		defer mu.Unlock()
+		now := timeNow()
+		if !last.IsZero() && now.Sub(last) < interval {
+			dropped++
+			return
+		}
+		last = now
+		var suffix string
+		if dropped > 0 {
+			suffix = fmt.Sprintf(" (%d more errors dropped)", dropped)
+			dropped = 0
+		}
+		fmt.Fprintf(w, "logging: failed to log record %d of module %q: %s%s\n", rec.ID, rec.Module, err, suffix)
+	}
+}
+
+// MultiError is returned by backends passing a record to several backends
+// when more than one of them fail.
+type MultiError []error
+
+// Error implements the error interface.
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// errorOrNil returns nil for no errors, the error itself for a single error
+// and the MultiError otherwise.
+func (e MultiError) errorOrNil() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingBackend fails every record with err.
+type failingBackend struct {
+	err   error
+	calls int
+}
+
+func (b *failingBackend) Log(level Level, calldepth int, rec *Record) error {
+	b.calls++
+	return b.err
+}
+
+func TestLoggerErrorHandler(t *testing.T) {
+	errDisk := errors.New("disk full")
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(&failingBackend{err: errDisk}))
+
+	var got []error
+	var msgs []string
+	log.SetErrorHandler(func(err error, rec *Record) {
+		got = append(got, err)
+		msgs = append(msgs, rec.Message())
+	})
+	log.Info("hello")
+	if len(got) != 1 || got[0] != errDisk || msgs[0] != "hello" {
+		t.Errorf("unexpected errors %v for %v", got, msgs)
+	}
+}
+
+func TestGlobalErrorHandler(t *testing.T) {
+	var got error
+	SetErrorHandler(func(err error, rec *Record) { got = err })
+	defer SetErrorHandler(RateLimitedErrorHandler(os.Stderr, defaultErrorInterval))
+
+	errDisk := errors.New("disk full")
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(&failingBackend{err: errDisk}))
+	log.Info("hello")
+	if got != errDisk {
+		t.Errorf("unexpected error %v", got)
+	}
+}
+
+func TestMultiLoggerErrors(t *testing.T) {
+	err1, err2 := errors.New("one"), errors.New("two")
+	log := MustGetLogger("test")
+	var got error
+	log.SetErrorHandler(func(err error, rec *Record) { got = err })
+
+	log.SetBackend(MultiLogger(&failingBackend{err: err1}, NewMemoryBackend(1)))
+	log.Info("hello")
+	if got != err1 {
+		t.Errorf("unexpected error %v", got)
+	}
+
+	log.SetBackend(MultiLogger(&failingBackend{err: err1}, &failingBackend{err: err2}))
+	log.Info("hello")
+	merr, ok := got.(MultiError)
+	if !ok || len(merr) != 2 || merr[0] != err1 || merr[1] != err2 {
+		t.Fatalf("unexpected error %#v", got)
+	}
+	if merr.Error() != "one; two" {
+		t.Errorf("unexpected message %q", merr.Error())
+	}
+}
+
+func TestRateLimitedErrorHandler(t *testing.T) {
+	now := time.Unix(1000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	var buf bytes.Buffer
+	h := RateLimitedErrorHandler(&buf, 10*time.Second)
+	rec := &Record{ID: 1, Module: "db"}
+	err := errors.New("disk full")
+
+	h(err, rec)
+	h(err, rec)
+	h(err, rec)
+	now = now.Add(10 * time.Second)
+	h(err, rec)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+	if !strings.Contains(lines[0], "disk full") || strings.Contains(lines[0], "dropped") {
+		t.Errorf("unexpected line %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "(2 more errors dropped)") {
+		t.Errorf("unexpected line %q", lines[1])
+	}
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ExitHandler is called by Fatal and Fatalf with the exit code once the
+// record has been logged. The shutdown functions are only run before the
+// default handler, os.Exit, a handler ending the program should call Shutdown
+// itself.
+type ExitHandler func(code int)
+
+// FatalPanic is the value Fatal and Fatalf panic with when PanicOnFatal is
+// enabled.
+type FatalPanic struct {
+	Module  string
+	Message string
+}
+
+// Error implements the error interface.
+func (p *FatalPanic) Error() string {
+	return "logger: fatal: " + p.Message
+}
+
+var exit struct {
+	sync.Mutex
+	handler  ExitHandler
+	panics   bool
+	shutdown []func()
+}
+
+// SetExitHandler replaces the handler used by all loggers without a handler
+// of their own. A nil handler restores the default, os.Exit.
+func SetExitHandler(h ExitHandler) {
+	exit.Lock()
+	defer exit.Unlock()
+	exit.handler = h
+}
+
+// PanicOnFatal makes Fatal and Fatalf panic with a *FatalPanic instead of
+// exiting, without running the shutdown functions. This is meant to be used
+// in tests to assert on code paths ending with a fatal log record.
+func PanicOnFatal(enabled bool) {
+	exit.Lock()
+	defer exit.Unlock()
+	exit.panics = enabled
+}
+
+// AtExit registers a function to be run by Shutdown, eg. to flush buffers or
+// close files before Fatal exits the program.
+func AtExit(fn func()) {
+	exit.Lock()
+	defer exit.Unlock()
+	exit.shutdown = append(exit.shutdown, fn)
+}
+
+// Shutdown runs the functions registered with AtExit, the most recently
+// registered first. Every function is run at most once. Shutdown is called by
+// Fatal and Fatalf before os.Exit and can be deferred in main to get the same
+// cleanup on a normal exit.
+func Shutdown() {
+	exit.Lock()
+	fns := exit.shutdown
+	exit.shutdown = nil
+	exit.Unlock()
+
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+}
+
+// exit ends the program after a fatal record has been logged.
+func (l *Logger) exit(msg string) {
+	exit.Lock()
+	panics, handler := exit.panics, exit.handler
+	exit.Unlock()
+
+	if panics {
+		panic(&FatalPanic{Module: l.Module, Message: msg})
+	}
+	if l.exitHandler != nil {
+		handler = l.exitHandler
+	}
+	if handler == nil {
+		// other handlers may not exit, the program could go on logging
+		Shutdown()
+		handler = os.Exit
+	}
+	handler(1)
+}
+
+// SetExitHandler overrides the exit handler for this logger, see
+// SetExitHandler. A nil handler restores the global one.
+func (l *Logger) SetExitHandler(h ExitHandler) {
+	l.exitHandler = h
+}
+
+func fatalMessage(format *string, args []interface{}) string {
+	if format != nil {
+		return fmt.Sprintf(*format, args...)
+	}
+	return fmt.Sprint(args...)
+}
@@ -0,0 +1,66 @@
+package logging
+
+import "testing"
+
+func TestFatalExitHandler(t *testing.T) {
+	InitForTesting(DEBUG)
+	defer SetExitHandler(nil)
+
+	var calls []string
+	AtExit(func() { calls = append(calls, "first") })
+	AtExit(func() { calls = append(calls, "second") })
+
+	// shutdown functions are left to custom handlers
+	code := -1
+	SetExitHandler(func(c int) { code = c })
+	log := MustGetLogger("test")
+	log.Fatalf("bye %d", 1)
+	if code != 1 {
+		t.Errorf("unexpected exit code: %d", code)
+	}
+	if len(calls) != 0 {
+		t.Errorf("shutdown functions run before a custom handler: %v", calls)
+	}
+
+	SetExitHandler(func(c int) { Shutdown() })
+	log.Fatal("bye")
+	if len(calls) != 2 || calls[0] != "second" || calls[1] != "first" {
+		t.Errorf("unexpected shutdown calls: %v", calls)
+	}
+
+	// shutdown functions only run once
+	log.Fatal("bye")
+	if len(calls) != 2 {
+		t.Errorf("shutdown functions run twice: %v", calls)
+	}
+
+	// per logger handler takes precedence
+	own := -1
+	log.SetExitHandler(func(c int) { own = c })
+	code = -1
+	log.Fatal("bye")
+	if own != 1 || code != -1 {
+		t.Errorf("unexpected exit codes: %d %d", own, code)
+	}
+}
+
+func TestPanicOnFatal(t *testing.T) {
+	backend := InitForTesting(DEBUG)
+	PanicOnFatal(true)
+	defer PanicOnFatal(false)
+
+	defer func() {
+		p, ok := recover().(*FatalPanic)
+		if !ok {
+			t.Fatalf("unexpected panic value: %v", p)
+		}
+		if p.Module != "test" || p.Message != "fatal 42" {
+			t.Errorf("unexpected fatal panic: %+v", p)
+		}
+		if MemoryRecordN(backend, 0).Level != CRITICAL {
+			t.Errorf("fatal record not logged")
+		}
+	}()
+	MustGetLogger("test").Fatalf("fatal %d", 42)
+	t.Fatal("fatal returned")
+}
@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// ExportText writes records, one per line, formatted by f. Since the records
+// are not formatted where they were logged, verbs depending on the caller,
+// eg. %{shortfile}, do not give meaningful output.
+func ExportText(w io.Writer, records []*Record, f Formatter) error {
+	var buf bytes.Buffer
+	for _, rec := range records {
+		buf.Reset()
+		if err := f.Format(0, rec, &buf); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportRecord is the JSON representation of a record written by ExportJSON.
+type exportRecord struct {
+	ID      uint64 `json:"id"`
+	Time    string `json:"time"`
+	Level   Level  `json:"level"`
+	Module  string `json:"module,omitempty"`
+	Message string `json:"message"`
+	Fields  Fields `json:"fields,omitempty"`
+}
+
+// ExportJSON writes records as JSON lines, ie. one JSON object per line with
+// the keys id, time, level, module, message and fields.
+func ExportJSON(w io.Writer, records []*Record) error {
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		err := enc.Encode(&exportRecord{
+			ID:      rec.ID,
+			Time:    rec.Time.Format(rfc3339Milli),
+			Level:   rec.Level,
+			Module:  rec.Module,
+			Message: rec.Message(),
+			Fields:  rec.Fields,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultRetryInterval is the default time after which a failing primary
+// backend is tried again.
+const defaultRetryInterval = 30 * time.Second
+
+// Failover is a backend writing to the first backend which does not fail.
+// Records are written to the active backend, which becomes the next one on
+// errors. Once RetryInterval has elapsed since the primary backend failed,
+// it is tried again and becomes active on success.
+type Failover struct {
+	// RetryInterval is the time after which the primary backend is tried
+	// again. It defaults to 30 seconds.
+	RetryInterval time.Duration
+
+	backends []Backend
+
+	mu       sync.Mutex
+	active   int
+	failedAt time.Time
+}
+
+// FailoverBackend creates a Failover backend writing to primary, and to the
+// secondary backends in order when it fails.
+func FailoverBackend(primary Backend, secondary ...Backend) *Failover {
+	return &Failover{
+		RetryInterval: defaultRetryInterval,
+		backends:      append([]Backend{primary}, secondary...),
+	}
+}
+
+// Active returns the index of the backend records are written to, 0 being
+// the primary backend.
+func (f *Failover) Active() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active
+}
+
+// Log implements the Backend interface. The errors of all backends are
+// returned as a MultiError if none of them succeeds.
+func (f *Failover) Log(level Level, calldepth int, rec *Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	start := f.active
+	if start > 0 && timeNow().Sub(f.failedAt) >= f.RetryInterval {
+		start = 0
+	}
+
+	// Backends before the active one are tried last, in case they recovered.
+	var errs MultiError
+	for n := 0; n < len(f.backends); n++ {
+		i := (start + n) % len(f.backends)
+		// Shallow copy of the record, as done by MultiLogger, so that a
+		// backend does not reuse the message formatted by a failed one.
+		r2 := *rec
+		err := f.backends[i].Log(level, calldepth+1, &r2)
+		if err == nil {
+			f.active = i
+			return nil
+		}
+		if i == 0 {
+			f.failedAt = timeNow()
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
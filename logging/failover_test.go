@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// toggleBackend fails while err is set.
+type toggleBackend struct {
+	err     error
+	records []string
+}
+
+func (b *toggleBackend) Log(level Level, calldepth int, rec *Record) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.records = append(b.records, rec.Formatted(calldepth+1))
+	return nil
+}
+
+func TestFailoverBackend(t *testing.T) {
+	now := time.Unix(1000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	primary := &toggleBackend{}
+	secondary := &toggleBackend{}
+	failover := FailoverBackend(primary, secondary)
+	failover.RetryInterval = time.Minute
+
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(failover))
+	var errs []error
+	log.SetErrorHandler(func(err error, rec *Record) { errs = append(errs, err) })
+
+	log.Info("a")
+	primary.err = errors.New("disk full")
+	log.Info("b")
+	if failover.Active() != 1 {
+		t.Errorf("expected secondary to be active")
+	}
+
+	// The primary is not retried before the interval elapsed.
+	primary.err = nil
+	now = now.Add(30 * time.Second)
+	log.Info("c")
+	now = now.Add(30 * time.Second)
+	log.Info("d")
+	if failover.Active() != 0 {
+		t.Errorf("expected primary to be active")
+	}
+
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if len(primary.records) != 2 || primary.records[0] != "a" || primary.records[1] != "d" {
+		t.Errorf("unexpected primary records %q", primary.records)
+	}
+	if len(secondary.records) != 2 || secondary.records[0] != "b" || secondary.records[1] != "c" {
+		t.Errorf("unexpected secondary records %q", secondary.records)
+	}
+}
+
+func TestFailoverBackendAllFail(t *testing.T) {
+	err1, err2 := errors.New("one"), errors.New("two")
+	failover := FailoverBackend(&toggleBackend{err: err1}, &toggleBackend{err: err2})
+
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(failover))
+	var got error
+	log.SetErrorHandler(func(err error, rec *Record) { got = err })
+	log.Info("a")
+
+	merr, ok := got.(MultiError)
+	if !ok || len(merr) != 2 || merr[0] != err1 || merr[1] != err2 {
+		t.Errorf("unexpected error %#v", got)
+	}
+}
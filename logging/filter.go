@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Predicate decides whether a record is passed on by a filter backend.
+type Predicate func(*Record) bool
+
+// filterBackend only passes records accepted by a predicate to a backend.
+type filterBackend struct {
+	b    Backend
+	pred Predicate
+}
+
+// FilterBackend creates a backend which passes the records for which pred
+// returns true to b and silently drops the others. It composes like any other
+// backend, eg.
+//
+//	healthz := regexp.MustCompile(`/healthz`)
+//	b := FilterBackend(NewLogBackend(os.Stderr, "", 0), Not(MessageMatches(healthz)))
+//	SetBackend(MultiLogger(b, FilterBackend(paymentsFile, ModuleIn("payments"))))
+func FilterBackend(b Backend, pred Predicate) Backend {
+	return &filterBackend{b, pred}
+}
+
+// Log implements the Backend interface.
+func (f *filterBackend) Log(level Level, calldepth int, rec *Record) error {
+	if !f.pred(rec) {
+		return nil
+	}
+	return f.b.Log(level, calldepth+1, rec)
+}
+
+// ModuleIn accepts records from any of the given modules.
+func ModuleIn(modules ...string) Predicate {
+	set := make(map[string]bool, len(modules))
+	for _, m := range modules {
+		set[m] = true
+	}
+	return func(rec *Record) bool {
+		return set[rec.Module]
+	}
+}
+
+// MessageMatches accepts records with a message matching re.
+func MessageMatches(re *regexp.Regexp) Predicate {
+	return func(rec *Record) bool {
+		return re.MatchString(rec.Message())
+	}
+}
+
+// MessageContains accepts records with a message containing substr.
+func MessageContains(substr string) Predicate {
+	return func(rec *Record) bool {
+		return strings.Contains(rec.Message(), substr)
+	}
+}
+
+// TimeBetween accepts records created in the time range from start, included,
+// to end, excluded. A zero start or end leaves the range open on that side.
+func TimeBetween(start, end time.Time) Predicate {
+	return func(rec *Record) bool {
+		return (start.IsZero() || !rec.Time.Before(start)) && (end.IsZero() || rec.Time.Before(end))
+	}
+}
+
+// LevelBetween accepts records with a level in the range from a to b, both
+// included, regardless of which one of them is the most severe.
+func LevelBetween(a, b Level) Predicate {
+	if b.enabledAt(a) {
+		a, b = b, a
+	}
+	return func(rec *Record) bool {
+		return a.enabledAt(rec.Level) && rec.Level.enabledAt(b)
+	}
+}
+
+// FieldEquals accepts records having the field key set to value.
+func FieldEquals(key string, value interface{}) Predicate {
+	return func(rec *Record) bool {
+		v, ok := rec.Fields[key]
+		return ok && reflect.DeepEqual(v, value)
+	}
+}
+
+// Not accepts the records rejected by pred.
+func Not(pred Predicate) Predicate {
+	return func(rec *Record) bool {
+		return !pred(rec)
+	}
+}
+
+// And accepts the records accepted by all predicates.
+func And(preds ...Predicate) Predicate {
+	return func(rec *Record) bool {
+		for _, pred := range preds {
+			if !pred(rec) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or accepts the records accepted by any of the predicates.
+func Or(preds ...Predicate) Predicate {
+	return func(rec *Record) bool {
+		for _, pred := range preds {
+			if pred(rec) {
+				return true
+			}
+		}
+		return false
+	}
+}
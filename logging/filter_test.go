@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestFilterBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	all := NewMemoryBackend(8)
+	payments := NewMemoryBackend(8)
+	healthz := regexp.MustCompile(`/healthz`)
+	SetBackend(
+		FilterBackend(all, Not(MessageMatches(healthz))),
+		NewBackendFormatter(
+			FilterBackend(payments, ModuleIn("payments")),
+			MustStringFormatter("%{level} %{message} %{fields}"),
+		),
+	)
+
+	MustGetLogger("http").Info("GET /healthz")
+	MustGetLogger("http").Info("GET /orders")
+	MustGetLogger("payments").WithFields(Fields{"id": 42}).Warning("charged")
+
+	if MemoryRecordN(all, 0).Message() != "GET /orders" || MemoryRecordN(all, 1).Message() != "charged" {
+		t.Errorf("unexpected records: %v %v", MemoryRecordN(all, 0), MemoryRecordN(all, 1))
+	}
+	if MemoryRecordN(all, 2) != nil {
+		t.Errorf("unexpected record: %v", MemoryRecordN(all, 2))
+	}
+	if getLastLine(payments) != "WARN charged id=42" {
+		t.Errorf("unexpected line: %s", getLastLine(payments))
+	}
+	if MemoryRecordN(payments, 1) != nil {
+		t.Errorf("unexpected record: %v", MemoryRecordN(payments, 1))
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	msg := "msg"
+	rec := &Record{Module: "db", Level: WARNING, fmt: &msg, Fields: Fields{"user": "bob", "n": 1}}
+
+	tests := []struct {
+		pred     Predicate
+		expected bool
+	}{
+		{ModuleIn("http", "db"), true},
+		{ModuleIn("http"), false},
+		{MessageMatches(regexp.MustCompile("^m")), true},
+		{LevelBetween(ERROR, NOTICE), true},
+		{LevelBetween(NOTICE, ERROR), true},
+		{LevelBetween(INFO, DEBUG), false},
+		{LevelBetween(CRITICAL, ERROR), false},
+		{FieldEquals("user", "bob"), true},
+		{FieldEquals("n", 1), true},
+		{FieldEquals("n", "1"), false},
+		{FieldEquals("missing", nil), false},
+		{And(ModuleIn("db"), FieldEquals("user", "bob")), true},
+		{And(ModuleIn("db"), FieldEquals("user", "alice")), false},
+		{Or(ModuleIn("http"), FieldEquals("user", "bob")), true},
+		{Not(ModuleIn("db")), false},
+	}
+	for i, test := range tests {
+		if actual := test.pred(rec); actual != test.expected {
+			t.Errorf("predicate %d: %v != %v", i, actual, test.expected)
+		}
+	}
+}
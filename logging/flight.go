@@ -0,0 +1,215 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultFlightBuffers is the default maximum number of buffers kept by a
+// FlightRecorder.
+const defaultFlightBuffers = 1024
+
+// KeyFunc returns the key used to group records, eg. by module.
+type KeyFunc func(*Record) string
+
+// ModuleKey groups records by module.
+func ModuleKey(rec *Record) string {
+	return rec.Module
+}
+
+// GoroutineKey groups records by the goroutine logging them.
+func GoroutineKey(rec *Record) string {
+	return GetGoroutineID()
+}
+
+// FieldKey groups records by the value of a field, eg. a request id.
+func FieldKey(name string) KeyFunc {
+	return func(rec *Record) string {
+		if v, ok := rec.Fields[name]; ok {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+}
+
+// FlightRecorder is a backend which writes records at or above its level, as
+// set with SetLevel, to the underlying backend and keeps the most recent
+// records below that level in memory. When a record at or above Trigger
+// arrives, the records kept in memory for the same key are written first,
+// surrounded by marker records, giving the debug context of an error while
+// normally logging at eg. INFO.
+//
+// The level of a FlightRecorder only decides what is written directly, the
+// records down to BufferLevel are kept in memory. Hence, loggers or backends
+// in front of it should not drop records below the level of interest.
+type FlightRecorder struct {
+	// Trigger is the least severe level which flushes the records kept in
+	// memory. It defaults to ERROR.
+	Trigger Level
+	// BufferLevel is the least severe level kept in memory, records below
+	// it and below the level of the recorder are dropped. It defaults to
+	// DEBUG.
+	BufferLevel Level
+	// Key groups the records kept in memory. It defaults to ModuleKey.
+	Key KeyFunc
+	// MaxBuffers limits the number of groups kept in memory, the least
+	// recently used group is dropped when exceeded.
+	MaxBuffers int
+
+	backend Backend
+	leveled *moduleLeveled
+	size    int
+	maxAge  time.Duration
+
+	mu      sync.Mutex
+	buffers map[string]*flightBuffer
+}
+
+// flightBuffer keeps the records of one group.
+type flightBuffer struct {
+	records *MemoryBackend
+	used    time.Time
+}
+
+// NewFlightRecorder creates a FlightRecorder writing to backend which keeps,
+// per group, up to size records no older than maxAge. A zero maxAge keeps
+// records regardless of their age.
+func NewFlightRecorder(backend Backend, size int, maxAge time.Duration) *FlightRecorder {
+	return &FlightRecorder{
+		Trigger:     ERROR,
+		BufferLevel: DEBUG,
+		Key:         ModuleKey,
+		MaxBuffers:  defaultFlightBuffers,
+		backend:     backend,
+		leveled:     newModuleLeveled(backend),
+		size:        size,
+		maxAge:      maxAge,
+		buffers:     make(map[string]*flightBuffer),
+	}
+}
+
+// GetLevel returns the level written directly for the given module.
+func (f *FlightRecorder) GetLevel(module string) Level {
+	return f.leveled.GetLevel(module)
+}
+
+// SetLevel sets the level written directly for the given module.
+func (f *FlightRecorder) SetLevel(level Level, module string) {
+	f.leveled.SetLevel(level, module)
+}
+
+// SetLevelRule sets the level written directly for modules matching pattern.
+func (f *FlightRecorder) SetLevelRule(pattern string, level Level) error {
+	return f.leveled.SetLevelRule(pattern, level)
+}
+
+// IsEnabledFor returns true if records of level are written directly or
+// kept in memory.
+func (f *FlightRecorder) IsEnabledFor(level Level, module string) bool {
+	return level.enabledAt(f.BufferLevel) || f.leveled.IsEnabledFor(level, module)
+}
+
+// Log implements the Backend interface.
+func (f *FlightRecorder) Log(level Level, calldepth int, rec *Record) error {
+	key := f.Key(rec)
+	if !f.leveled.IsEnabledFor(level, rec.Module) {
+		if !level.enabledAt(f.BufferLevel) {
+			return nil
+		}
+		// The record is formatted later, away from the logging call.
+		rec.captureCaller(calldepth + 1)
+		f.keep(key, rec)
+		return nil
+	}
+	if level.enabledAt(f.Trigger) {
+		if err := f.flush(key, calldepth+1, rec); err != nil {
+			return err
+		}
+	}
+	return f.leveled.Log(level, calldepth+1, rec)
+}
+
+func (f *FlightRecorder) keep(key string, rec *Record) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	buf, ok := f.buffers[key]
+	if !ok {
+		if f.MaxBuffers > 0 && len(f.buffers) >= f.MaxBuffers {
+			f.evict()
+		}
+		buf = &flightBuffer{records: NewMemoryBackend(f.size)}
+		f.buffers[key] = buf
+	}
+	buf.used = rec.Time
+	buf.records.Log(rec.Level, 0, rec)
+}
+
+// evict drops the least recently used buffer.
+func (f *FlightRecorder) evict() {
+	var oldest string
+	var used time.Time
+	for key, buf := range f.buffers {
+		if used.IsZero() || buf.used.Before(used) {
+			oldest, used = key, buf.used
+		}
+	}
+	delete(f.buffers, oldest)
+}
+
+// flush writes the records kept for key, logged before the trigger record.
+// The buffer is taken out under the lock and written after releasing it, so
+// that a slow backend does not block the other loggers.
+func (f *FlightRecorder) flush(key string, calldepth int, trigger *Record) error {
+	f.mu.Lock()
+	buf, ok := f.buffers[key]
+	delete(f.buffers, key)
+	f.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var records []*Record
+	for _, rec := range buf.records.Records() {
+		if f.maxAge <= 0 || trigger.Time.Sub(rec.Time) <= f.maxAge {
+			records = append(records, rec)
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	formatter := f.leveled.getFormatterAndCacheCurrent()
+	write := func(rec *Record) error {
+		if rec.formatter == nil {
+			rec.formatter = formatter
+		}
+		return f.backend.Log(rec.Level, calldepth+2, rec)
+	}
+	if err := write(f.marker(trigger, calldepth+1, "--- flight recorder: %d records before %s ---", len(records), trigger.Level.Name())); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := write(rec); err != nil {
+			return err
+		}
+	}
+	return write(f.marker(trigger, calldepth+1, "--- flight recorder: end ---"))
+}
+
+// marker creates a record delimiting the flushed records.
+func (f *FlightRecorder) marker(trigger *Record, calldepth int, format string, args ...interface{}) *Record {
+	rec := &Record{
+		ID:     atomic.AddUint64(&sequenceNo, 1),
+		Time:   trigger.Time,
+		Module: trigger.Module,
+		Level:  NOTICE,
+		Args:   args,
+		Fields: trigger.Fields,
+		fmt:    &format,
+	}
+	rec.captureCaller(calldepth + 1)
+	return rec
+}
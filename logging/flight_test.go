@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlightRecorder(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	buf := &bytes.Buffer{}
+	recorder := NewFlightRecorder(
+		NewBackendFormatter(NewLogBackend(buf, "", 0), MustStringFormatter("%{shortfile} %{level} %{message}")),
+		3, 0)
+	recorder.SetLevel(INFO, "")
+
+	db := MustGetLogger("db")
+	db.SetBackend(recorder)
+	http := MustGetLogger("http")
+	http.SetBackend(recorder)
+
+	for i := 0; i < 5; i++ {
+		db.Debugf("query %d", i)
+	}
+	http.Debug("request")
+	db.Info("connected")
+	db.Error("failed")
+	db.Error("failed again")
+
+	expected := []string{
+		"flight_test.go:28 INFO connected",
+		"flight_test.go:29 NOTI --- flight recorder: 3 records before error ---",
+		"flight_test.go:25 DEBU query 2",
+		"flight_test.go:25 DEBU query 3",
+		"flight_test.go:25 DEBU query 4",
+		"flight_test.go:29 NOTI --- flight recorder: end ---",
+		"flight_test.go:29 ERRO failed",
+		"flight_test.go:30 ERRO failed again",
+		"",
+	}
+	if buf.String() != strings.Join(expected, "\n") {
+		t.Errorf("unexpected lines:\n%s", buf.String())
+	}
+
+	// records of other modules are still kept
+	buf.Reset()
+	http.Critical("crashed")
+	if !strings.Contains(buf.String(), "DEBU request") {
+		t.Errorf("http records not flushed: %s", buf.String())
+	}
+}
+
+func TestFlightRecorderMaxAge(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	backend := NewMemoryBackend(64)
+	recorder := NewFlightRecorder(backend, 10, time.Minute)
+	recorder.SetLevel(INFO, "")
+	recorder.Key = FieldKey("req")
+	log := MustGetLogger("test")
+	log.SetBackend(recorder)
+
+	now := time.Unix(0, 0)
+	timeNow = func() time.Time { return now }
+	log.WithFields(Fields{"req": 1}).Debug("old")
+	now = now.Add(2 * time.Minute)
+	log.WithFields(Fields{"req": 1}).Debug("recent")
+	log.WithFields(Fields{"req": 2}).Debug("other request")
+	log.WithFields(Fields{"req": 1}).Error("failed")
+
+	var messages []string
+	for _, rec := range backend.Records() {
+		messages = append(messages, rec.Message())
+	}
+	if len(messages) != 4 || messages[1] != "recent" || messages[3] != "failed" {
+		t.Errorf("unexpected messages: %v", messages)
+	}
+}
+
+func TestFlightRecorderMaxBuffers(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	backend := NewMemoryBackend(64)
+	recorder := NewFlightRecorder(backend, 10, 0)
+	recorder.SetLevel(INFO, "")
+	recorder.MaxBuffers = 2
+
+	for i, module := range []string{"a", "b", "c"} {
+		now := time.Unix(int64(i), 0)
+		timeNow = func() time.Time { return now }
+		log := MustGetLogger(module)
+		log.SetBackend(recorder)
+		log.Debug(module)
+	}
+	if _, ok := recorder.buffers["a"]; ok || len(recorder.buffers) != 2 {
+		t.Errorf("least recently used buffer not evicted: %v", recorder.buffers)
+	}
+}
+
+func TestFlightRecorderBufferLevel(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	backend := NewMemoryBackend(64)
+	recorder := NewFlightRecorder(backend, 10, 0)
+	recorder.SetLevel(INFO, "")
+	if recorder.IsEnabledFor(TRACE, "test") || !recorder.IsEnabledFor(DEBUG, "test") || !recorder.IsEnabledFor(INFO, "test") {
+		t.Errorf("unexpected enabled levels")
+	}
+	log := MustGetLogger("test")
+	log.SetBackend(recorder)
+	log.Trace("dropped")
+	log.Debug("kept")
+	log.Error("failed")
+
+	var messages []string
+	for _, rec := range backend.Records() {
+		messages = append(messages, rec.Message())
+	}
+	if len(messages) != 4 || messages[1] != "kept" || messages[3] != "failed" {
+		t.Errorf("unexpected messages: %v", messages)
+	}
+
+	recorder.BufferLevel = TRACE
+	if !recorder.IsEnabledFor(TRACE, "test") {
+		t.Errorf("trace not enabled")
+	}
+}
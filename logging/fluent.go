@@ -0,0 +1,209 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FluentOptions configure a FluentBackend.
+type FluentOptions struct {
+	BatchOptions
+	// TagPrefix is prepended to the module name to form the tag of the
+	// records, eg. "app.db". It defaults to the name of the program.
+	TagPrefix string
+	// RequireAck makes the server acknowledge each chunk of records, chunks
+	// not acknowledged within AckTimeout are sent again.
+	RequireAck bool
+	AckTimeout time.Duration
+	// DialTimeout and WriteTimeout limit the time spent connecting to the
+	// server and writing records. They default to 5 seconds.
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// FluentBackend sends records in batches to Fluentd or Fluent Bit using the
+// Forward protocol in PackedForward mode, over tcp or a unix socket. The
+// records carry the message, level, module and caller with the fields.
+type FluentBackend struct {
+	network string
+	addr    string
+	opts    FluentOptions
+	batch   *batcher
+
+	mu   sync.Mutex // guards conn, used by the batcher and Close
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// NewFluentBackend creates a FluentBackend sending to addr on network, eg.
+// "tcp" and "localhost:24224". The connection is made when sending the first
+// batch. Close should be called to send the pending records before the
+// program exits.
+func NewFluentBackend(network, addr string, opts FluentOptions) *FluentBackend {
+	if opts.TagPrefix == "" {
+		opts.TagPrefix = filepath.Base(os.Args[0])
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = 10 * time.Second
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 5 * time.Second
+	}
+	b := &FluentBackend{network: network, addr: addr, opts: opts}
+	b.batch = newBatcher(opts.BatchOptions, b.send)
+	return b
+}
+
+// Log implements the Backend interface.
+func (b *FluentBackend) Log(level Level, calldepth int, rec *Record) error {
+	record := map[string]interface{}{}
+	for k, v := range rec.Fields {
+		record[k] = v
+	}
+	record["message"] = rec.Message()
+	record["level"] = rec.Level.Name()
+	if rec.Module != "" {
+		record["module"] = rec.Module
+	}
+	if frame, ok := rec.Caller(calldepth + 1); ok {
+		record["caller"] = fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+	}
+
+	// each entry is [time, record], ready to be packed
+	var buf bytes.Buffer
+	enc := msgpackEncoder{&buf}
+	enc.encodeArrayHeader(2)
+	enc.encodeEventTime(rec.Time)
+	enc.encode(record)
+	return b.batch.add(rec, buf.Bytes())
+}
+
+// Flush sends the pending records and waits until they are sent.
+func (b *FluentBackend) Flush() {
+	b.batch.Flush()
+}
+
+// Close sends the pending records, stops the backend and closes the
+// connection.
+func (b *FluentBackend) Close() error {
+	b.batch.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn = nil
+	return err
+}
+
+// Stats returns the number of records sent and dropped.
+func (b *FluentBackend) Stats() BatchStats {
+	return b.batch.Stats()
+}
+
+// Tag returns the tag of the records of module.
+func (b *FluentBackend) Tag(module string) string {
+	if module == "" {
+		return b.opts.TagPrefix
+	}
+	return b.opts.TagPrefix + "." + module
+}
+
+// send writes one PackedForward message per tag. When a message fails, it
+// and the following ones are retried.
+func (b *FluentBackend) send(batch []batchEntry) error {
+	var tags []string
+	groups := make(map[string][]batchEntry)
+	for _, e := range batch {
+		tag := b.Tag(e.rec.Module)
+		if _, ok := groups[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		groups[tag] = append(groups[tag], e)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, tag := range tags {
+		if err := b.sendPacked(tag, groups[tag]); err != nil {
+			if b.conn != nil {
+				b.conn.Close()
+				b.conn = nil
+			}
+			var retry []batchEntry
+			for _, tag := range tags[i:] {
+				retry = append(retry, groups[tag]...)
+			}
+			return &partialFailure{retry: retry, retryErr: err}
+		}
+	}
+	return nil
+}
+
+// sendPacked writes entries as a PackedForward message and waits for its
+// acknowledgment if required.
+func (b *FluentBackend) sendPacked(tag string, entries []batchEntry) error {
+	if b.conn == nil {
+		conn, err := net.DialTimeout(b.network, b.addr, b.opts.DialTimeout)
+		if err != nil {
+			return err
+		}
+		b.conn, b.r = conn, bufio.NewReader(conn)
+	}
+
+	var entriesBuf bytes.Buffer
+	for _, e := range entries {
+		entriesBuf.Write(e.data)
+	}
+	option := map[string]interface{}{"size": len(entries)}
+	var chunk string
+	if b.opts.RequireAck {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+		option["chunk"] = chunk
+	}
+
+	var msg bytes.Buffer
+	enc := msgpackEncoder{&msg}
+	enc.encodeArrayHeader(3)
+	enc.encodeString(tag)
+	enc.encodeBytes(entriesBuf.Bytes())
+	enc.encode(option)
+
+	if err := b.conn.SetWriteDeadline(time.Now().Add(b.opts.WriteTimeout)); err != nil {
+		return err
+	}
+	if _, err := b.conn.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if !b.opts.RequireAck {
+		return nil
+	}
+
+	if err := b.conn.SetReadDeadline(time.Now().Add(b.opts.AckTimeout)); err != nil {
+		return err
+	}
+	resp, err := decodeMsgpack(b.r)
+	if err != nil {
+		return fmt.Errorf("logging: waiting for fluentd ack: %s", err)
+	}
+	if m, ok := resp.(map[string]interface{}); !ok || m["ack"] != chunk {
+		return fmt.Errorf("logging: unexpected fluentd ack %v", resp)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// fluentMessage is a decoded PackedForward message.
+type fluentMessage struct {
+	tag     string
+	times   []time.Time
+	records []map[string]interface{}
+	option  map[string]interface{}
+}
+
+// fluentStandIn accepts connections on ln, decodes the messages and
+// acknowledges the chunks unless ack is false.
+func fluentStandIn(t *testing.T, ln net.Listener, ack bool) <-chan fluentMessage {
+	messages := make(chan fluentMessage, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					v, err := decodeMsgpack(r)
+					if err != nil {
+						return
+					}
+					msg, ok := decodeFluentMessage(v)
+					if !ok {
+						t.Errorf("invalid message %v", v)
+						return
+					}
+					if chunk, ok := msg.option["chunk"].(string); ok && ack {
+						var buf bytes.Buffer
+						msgpackEncoder{&buf}.encode(map[string]interface{}{"ack": chunk})
+						conn.Write(buf.Bytes())
+					}
+					messages <- msg
+				}
+			}()
+		}
+	}()
+	return messages
+}
+
+func decodeFluentMessage(v interface{}) (fluentMessage, bool) {
+	var msg fluentMessage
+	a, ok := v.([]interface{})
+	if !ok || len(a) != 3 {
+		return msg, false
+	}
+	msg.tag, _ = a[0].(string)
+	msg.option, _ = a[2].(map[string]interface{})
+	entries, ok := a[1].([]byte)
+	if !ok {
+		return msg, false
+	}
+	r := bufio.NewReader(bytes.NewReader(entries))
+	for {
+		entry, err := decodeMsgpack(r)
+		if err != nil {
+			break
+		}
+		e, ok := entry.([]interface{})
+		if !ok || len(e) != 2 {
+			return msg, false
+		}
+		ext, ok := e[0].(msgpackExt)
+		if !ok || ext.Type != 0 || len(ext.Data) != 8 {
+			return msg, false
+		}
+		sec := binary.BigEndian.Uint32(ext.Data[:4])
+		nsec := binary.BigEndian.Uint32(ext.Data[4:])
+		msg.times = append(msg.times, time.Unix(int64(sec), int64(nsec)))
+		record, _ := e[1].(map[string]interface{})
+		msg.records = append(msg.records, record)
+	}
+	return msg, msg.option["size"] == int64(len(msg.records))
+}
+
+func nextFluentMessage(t *testing.T, messages <-chan fluentMessage) fluentMessage {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	return fluentMessage{}
+}
+
+func TestFluentBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 123456789, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	messages := fluentStandIn(t, ln, true)
+
+	backend := NewFluentBackend("tcp", ln.Addr().String(), FluentOptions{
+		TagPrefix:  "app",
+		RequireAck: true,
+	})
+	defer backend.Close()
+	db := MustGetLogger("db")
+	db.SetBackend(AddModuleLevel(backend))
+	web := MustGetLogger("http")
+	web.SetBackend(AddModuleLevel(backend))
+
+	db.WithFields(Fields{"rows": 3}).Info("query")
+	web.Warning("slow")
+	db.Error("failed")
+	backend.Flush()
+
+	msg := nextFluentMessage(t, messages)
+	if msg.tag != "app.db" || len(msg.records) != 2 || msg.option["chunk"] == nil {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if !msg.times[0].Equal(now) {
+		t.Errorf("unexpected time %v", msg.times[0])
+	}
+	expected := map[string]interface{}{
+		"message": "query",
+		"level":   "info",
+		"module":  "db",
+		"caller":  "fluent_test.go:128",
+		"rows":    int64(3),
+	}
+	for k, v := range expected {
+		if msg.records[0][k] != v {
+			t.Errorf("unexpected %s: %v != %v", k, msg.records[0][k], v)
+		}
+	}
+	if msg.records[1]["message"] != "failed" {
+		t.Errorf("unexpected record %v", msg.records[1])
+	}
+	if msg = nextFluentMessage(t, messages); msg.tag != "app.http" || msg.records[0]["message"] != "slow" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if stats := backend.Stats(); stats.Sent != 3 || stats.Retries != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestFluentBackendAckTimeout(t *testing.T) {
+	InitForTesting(DEBUG)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	messages := fluentStandIn(t, ln, false)
+
+	backend := NewFluentBackend("tcp", ln.Addr().String(), FluentOptions{
+		BatchOptions: BatchOptions{MaxRetries: 1, MinBackoff: time.Millisecond},
+		RequireAck:   true,
+		AckTimeout:   10 * time.Millisecond,
+	})
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	var errs []error
+	SetErrorHandler(func(err error, rec *Record) { errs = append(errs, err) })
+	defer SetErrorHandler(RateLimitedErrorHandler(os.Stderr, defaultErrorInterval))
+	log.Info("lost")
+	backend.Close()
+
+	// sent and retried once, without ack
+	for i := 0; i < 2; i++ {
+		if msg := nextFluentMessage(t, messages); msg.records[0]["message"] != "lost" {
+			t.Errorf("unexpected message %+v", msg)
+		}
+	}
+	if stats := backend.Stats(); stats.Failed != 1 || stats.Retries != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if len(errs) != 1 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestFluentBackendUnix(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("unix sockets not supported")
+	}
+	InitForTesting(DEBUG)
+	path := filepath.Join(t.TempDir(), "fluent.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	messages := fluentStandIn(t, ln, true)
+
+	backend := NewFluentBackend("unix", path, FluentOptions{TagPrefix: "app"})
+	log := MustGetLogger("")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("hello")
+	backend.Close()
+
+	if msg := nextFluentMessage(t, messages); msg.tag != "app" || msg.records[0]["message"] != "hello" || msg.option["chunk"] != nil {
+		t.Errorf("unexpected message %+v", msg)
+	}
+}
@@ -44,6 +44,7 @@ const (
 	fmtVerbLevelColor
 	fmtVerbGoroutineId
 	fmtVerbGoroutineCount
+	fmtVerbFields
 
 	// Keep last, there are no match for these below.
 	fmtVerbUnknown
@@ -68,6 +69,7 @@ var fmtVerbs = []string{
 	"color",
 	"goroutineid",
 	"goroutinecount",
+	"fields",
 }
 
 const rfc3339Milli = "2006-01-02T15:04:05.999Z07:00"
@@ -90,6 +92,7 @@ var defaultVerbsLayout = []string{
 	"",
 	"s",
 	"d",
+	"s",
 }
 
 var (
@@ -171,6 +174,7 @@ type stringFormatter struct {
 //     %{shortfile} Final file name element and line number: d.go:23
 //     %{callpath}  Callpath like main.a.b.c...c  "..." meaning recursive call ~. meaning truncated path
 //     %{color}     ANSI color based on log level
+//     %{fields}    Fields as key=value pairs sorted by key (string)
 //
 // For normal types, the output can be customized by using the 'verbs' defined
 // in the fmt package, eg. '%{id:04d}' to make the id output be '%04d' as the
@@ -318,8 +322,12 @@ func (f *stringFormatter) Format(calldepth int, r *Record, output io.Writer) err
 			case fmtVerbMessage:
 				v = r.Message()
 				break
+			case fmtVerbFields:
+				v = r.Fields.String()
+				break
 			case fmtVerbLongfile, fmtVerbShortfile:
-				_, file, line, ok := runtime.Caller(calldepth + 1)
+				frame, ok := r.Caller(calldepth + 1)
+				file, line := frame.File, frame.Line
 				if !ok {
 					file = "???"
 					line = 0
@@ -329,12 +337,9 @@ func (f *stringFormatter) Format(calldepth int, r *Record, output io.Writer) err
 				v = fmt.Sprintf("%s:%d", file, line)
 			case fmtVerbLongfunc, fmtVerbShortfunc,
 				fmtVerbLongpkg, fmtVerbShortpkg:
-				// TODO cache pc
 				v = "???"
-				if pc, _, _, ok := runtime.Caller(calldepth + 1); ok {
-					if f := runtime.FuncForPC(pc); f != nil {
-						v = formatFuncName(part.verb, f.Name())
-					}
+				if frame, ok := r.Caller(calldepth + 1); ok && frame.Function != "" {
+					v = formatFuncName(part.verb, frame.Function)
 				}
 			default:
 				panic("unhandled format part")
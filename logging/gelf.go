@@ -0,0 +1,243 @@
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// GELFCompression is the compression of GELF messages sent over udp.
+type GELFCompression int
+
+// GELF compressions.
+const (
+	GELFUncompressed GELFCompression = iota
+	GELFGzip
+	GELFZlib
+)
+
+const (
+	// defaultGELFChunkSize is the default size of the udp datagrams, small
+	// enough for most networks.
+	defaultGELFChunkSize = 1420
+	// gelfChunkHeader is the size of the header of a chunk: the magic bytes,
+	// the message id, the sequence number and count.
+	gelfChunkHeader = 12
+	gelfMaxChunks   = 128
+)
+
+// ErrGELFTooLarge is returned when a message does not fit in 128 chunks.
+var ErrGELFTooLarge = errors.New("logging: GELF message too large")
+
+// gelfFieldName matches the names allowed for additional fields.
+var gelfFieldName = regexp.MustCompile(`[^\w.\-]`)
+
+// gelfFormatter formats records as GELF 1.1 messages.
+type gelfFormatter struct {
+	host string
+}
+
+// NewGELFFormatter creates a Formatter writing records as GELF 1.1 messages
+// from host, the name of the host if empty. The first line of the message is
+// the short_message and multi-line messages, eg. with a stack trace, are also
+// sent as full_message. The module, the caller and the fields of the record
+// are sent as the additional fields _module, _file, _line, _func and _<name>.
+func NewGELFFormatter(host string) Formatter {
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return &gelfFormatter{host: host}
+}
+
+// Format implements the Formatter interface.
+func (f *gelfFormatter) Format(calldepth int, r *Record, output io.Writer) error {
+	msg := r.Message()
+	short := msg
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		short = strings.TrimRight(msg[:i], "\r")
+	}
+	m := map[string]interface{}{
+		"version":       "1.1",
+		"host":          f.host,
+		"short_message": short,
+		"timestamp":     float64(r.Time.UnixNano()/1e6) / 1e3,
+		"level":         int(r.Level.Severity()),
+	}
+	if short != msg {
+		m["full_message"] = msg
+	}
+	if r.Module != "" {
+		m["_module"] = r.Module
+	}
+	if frame, ok := r.Caller(calldepth + 1); ok {
+		m["_file"] = frame.File
+		m["_line"] = frame.Line
+		m["_func"] = frame.Function
+	}
+	for k, v := range r.Fields {
+		name := "_" + gelfFieldName.ReplaceAllString(k, "_")
+		if name == "_id" {
+			// _id is reserved by Graylog
+			name = "__id"
+		}
+		if _, ok := m[name]; ok {
+			continue
+		}
+		switch v.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			m[name] = v
+		default:
+			m[name] = fmt.Sprint(v)
+		}
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(data)
+	return err
+}
+
+// GELFOptions configure a GELFUDPBackend.
+type GELFOptions struct {
+	// Host is the host of the messages, the name of the host by default.
+	Host string
+	// Compression compresses the messages, they are uncompressed by
+	// default.
+	Compression GELFCompression
+	// ChunkSize is the maximum size of a datagram, messages which do not
+	// fit are chunked. It defaults to 1420.
+	ChunkSize int
+}
+
+// GELFUDPBackend sends records to Graylog as GELF messages over udp.
+type GELFUDPBackend struct {
+	formatter   Formatter
+	compression GELFCompression
+	chunkSize   int
+	conn        net.Conn
+}
+
+// NewGELFUDPBackend creates a GELFUDPBackend sending to addr.
+func NewGELFUDPBackend(addr string, opts GELFOptions) (*GELFUDPBackend, error) {
+	if opts.ChunkSize <= gelfChunkHeader {
+		opts.ChunkSize = defaultGELFChunkSize
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &GELFUDPBackend{
+		formatter:   NewGELFFormatter(opts.Host),
+		compression: opts.Compression,
+		chunkSize:   opts.ChunkSize,
+		conn:        conn,
+	}, nil
+}
+
+// Close closes the connection.
+func (b *GELFUDPBackend) Close() error {
+	return b.conn.Close()
+}
+
+// Log implements the Backend interface.
+func (b *GELFUDPBackend) Log(level Level, calldepth int, rec *Record) error {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch b.compression {
+	case GELFGzip:
+		w = gzip.NewWriter(&buf)
+	case GELFZlib:
+		w = zlib.NewWriter(&buf)
+	}
+	if w != nil {
+		if err := b.formatter.Format(calldepth+1, rec, w); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	} else if err := b.formatter.Format(calldepth+1, rec, &buf); err != nil {
+		return err
+	}
+	return b.write(buf.Bytes())
+}
+
+// write sends data in a single datagram, or in chunks if too large.
+func (b *GELFUDPBackend) write(data []byte) error {
+	if len(data) <= b.chunkSize {
+		_, err := b.conn.Write(data)
+		return err
+	}
+
+	size := b.chunkSize - gelfChunkHeader
+	count := (len(data) + size - 1) / size
+	if count > gelfMaxChunks {
+		return ErrGELFTooLarge
+	}
+	chunk := make([]byte, b.chunkSize)
+	chunk[0], chunk[1] = 0x1e, 0x0f
+	if _, err := rand.Read(chunk[2:10]); err != nil {
+		return err
+	}
+	chunk[11] = byte(count)
+	for i := 0; i < count; i++ {
+		chunk[10] = byte(i)
+		n := copy(chunk[gelfChunkHeader:], data[i*size:])
+		if _, err := b.conn.Write(chunk[:gelfChunkHeader+n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GELFTCPBackend sends records to Graylog as null terminated GELF messages
+// over tcp, optionally with TLS, reconnecting and buffering as a
+// NetworkBackend.
+type GELFTCPBackend struct {
+	formatter Formatter
+	conn      *NetworkBackend
+}
+
+// NewGELFTCPBackend creates a GELFTCPBackend sending to addr from host, the
+// name of the host if empty. The framing of opts is ignored.
+func NewGELFTCPBackend(addr, host string, opts NetworkOptions) (*GELFTCPBackend, error) {
+	opts.Framing = NullFraming
+	conn, err := NewNetworkBackend("tcp", addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &GELFTCPBackend{
+		formatter: NewGELFFormatter(host),
+		conn:      conn,
+	}, nil
+}
+
+// Connected returns true if the backend is connected to Graylog.
+func (b *GELFTCPBackend) Connected() bool {
+	return b.conn.Connected()
+}
+
+// Close closes the connection.
+func (b *GELFTCPBackend) Close() error {
+	return b.conn.Close()
+}
+
+// Log implements the Backend interface.
+func (b *GELFTCPBackend) Log(level Level, calldepth int, rec *Record) error {
+	var buf bytes.Buffer
+	if err := b.formatter.Format(calldepth+1, rec, &buf); err != nil {
+		return err
+	}
+	return b.conn.send(buf.String())
+}
@@ -0,0 +1,205 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGELFFormatter(t *testing.T) {
+	backend := InitForTesting(DEBUG)
+	SetFormatter(NewGELFFormatter("host"))
+	defer SetFormatter(DefaultFormatter)
+
+	log := MustGetLogger("module")
+	log.WithFields(Fields{"id": 1, "user name": "bob", "ratio": 0.5}).Error("failed\ngoroutine 1 [running]:")
+
+	var m map[string]interface{}
+	line := MemoryRecordN(backend, 0).Formatted(0)
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		t.Fatalf("invalid json %s: %s", line, err)
+	}
+	expected := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "host",
+		"short_message": "failed",
+		"full_message":  "failed\ngoroutine 1 [running]:",
+		"timestamp":     float64(0),
+		"level":         float64(3),
+		"_module":       "module",
+		"_line":         float64(25),
+		"_func":         "github.com/qjpcpu/log/logging.TestGELFFormatter",
+		"__id":          float64(1),
+		"_user_name":    "bob",
+		"_ratio":        0.5,
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("unexpected %s: %v != %v", k, m[k], v)
+		}
+	}
+	if file, _ := m["_file"].(string); filepath.Base(file) != "gelf_test.go" {
+		t.Errorf("unexpected file %v", m["_file"])
+	}
+	if len(m) != len(expected)+1 {
+		t.Errorf("unexpected keys %v", m)
+	}
+}
+
+func TestGELFUDPBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	backend, err := NewGELFUDPBackend(conn.LocalAddr().String(), GELFOptions{Host: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("hello")
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(readDatagram(t, conn)), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["short_message"] != "hello" || m["host"] != "host" {
+		t.Errorf("unexpected message %v", m)
+	}
+}
+
+func TestGELFUDPBackendChunked(t *testing.T) {
+	InitForTesting(DEBUG)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	backend, err := NewGELFUDPBackend(conn.LocalAddr().String(), GELFOptions{
+		Compression: GELFGzip,
+		ChunkSize:   100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+
+	// random enough not to compress into a single chunk
+	var msg strings.Builder
+	for i := 0; i < 200; i++ {
+		msg.WriteString(time.Duration(i * i * 7919).String())
+	}
+	log.Info(msg.String())
+
+	var chunks [][]byte
+	var id []byte
+	for count := 1; len(chunks) < count; {
+		chunk := []byte(readDatagram(t, conn))
+		if len(chunk) > 100 || chunk[0] != 0x1e || chunk[1] != 0x0f {
+			t.Fatalf("invalid chunk %q", chunk)
+		}
+		if id == nil {
+			id, count = chunk[2:10], int(chunk[11])
+			chunks = make([][]byte, 0, count)
+		}
+		if !bytes.Equal(id, chunk[2:10]) || int(chunk[10]) != len(chunks) {
+			t.Fatalf("unexpected chunk header %v", chunk[:12])
+		}
+		chunks = append(chunks, chunk[12:])
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(bytes.Join(chunks, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["short_message"] != msg.String() {
+		t.Errorf("unexpected message %v", m["short_message"])
+	}
+}
+
+func TestGELFUDPBackendTooLarge(t *testing.T) {
+	InitForTesting(DEBUG)
+	backend, err := NewGELFUDPBackend("127.0.0.1:9", GELFOptions{ChunkSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	if err := backend.write(make([]byte, 88*128+1)); err != ErrGELFTooLarge {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestGELFTCPBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	messages := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := r.ReadString(0)
+			if err != nil {
+				return
+			}
+			messages <- msg[:len(msg)-1]
+		}
+	}()
+
+	backend, err := NewGELFTCPBackend(ln.Addr().String(), "host", NetworkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("multi\nline")
+	log.Info("second")
+
+	for _, expected := range []string{"multi", "second"} {
+		select {
+		case msg := <-messages:
+			var m map[string]interface{}
+			if err := json.Unmarshal([]byte(msg), &m); err != nil {
+				t.Fatal(err)
+			}
+			if m["short_message"] != expected {
+				t.Errorf("unexpected message %v", m)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+		}
+	}
+}
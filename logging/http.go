@@ -0,0 +1,186 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPEncoding is the body of the requests sent by an HTTPBackend.
+type HTTPEncoding int
+
+// HTTP encodings.
+const (
+	// JSONLines sends one record per line.
+	JSONLines HTTPEncoding = iota
+	// JSONArray sends the records as a JSON array, which requires records
+	// formatted as JSON.
+	JSONArray
+)
+
+// HTTPOptions configure an HTTPBackend.
+type HTTPOptions struct {
+	BatchOptions
+	// Encoding is the body of the requests, JSONLines by default.
+	Encoding HTTPEncoding
+	// Formatter formats the records, JSONFormatter by default.
+	Formatter Formatter
+	// Header is added to each request.
+	Header http.Header
+	// Username and Password set basic authentication, BearerToken sets a
+	// bearer token.
+	Username    string
+	Password    string
+	BearerToken string
+	// Client sends the requests, a client with a 10 seconds timeout by
+	// default.
+	Client *http.Client
+}
+
+// HTTPBackend posts records in batches to a log ingestion endpoint. Batches
+// failing with 5xx or 429 responses, or network errors, are retried.
+type HTTPBackend struct {
+	url   string
+	opts  HTTPOptions
+	batch *batcher
+}
+
+// NewHTTPBackend creates an HTTPBackend posting to url. Close should be called
+// to send the pending records before the program exits.
+func NewHTTPBackend(url string, opts HTTPOptions) *HTTPBackend {
+	opts.setDefaults()
+	b := &HTTPBackend{url: url, opts: opts}
+	b.batch = newBatcher(opts.BatchOptions, b.send)
+	return b
+}
+
+// Log implements the Backend interface.
+func (b *HTTPBackend) Log(level Level, calldepth int, rec *Record) error {
+	var buf bytes.Buffer
+	if err := b.opts.Formatter.Format(calldepth+1, rec, &buf); err != nil {
+		return err
+	}
+	return b.batch.add(rec, buf.Bytes())
+}
+
+// Flush sends the pending records and waits until they are sent.
+func (b *HTTPBackend) Flush() {
+	b.batch.Flush()
+}
+
+// Close sends the pending records and stops the backend.
+func (b *HTTPBackend) Close() {
+	b.batch.Close()
+}
+
+// Stats returns the number of records sent and dropped.
+func (b *HTTPBackend) Stats() BatchStats {
+	return b.batch.Stats()
+}
+
+func (b *HTTPBackend) send(batch []batchEntry) error {
+	var body bytes.Buffer
+	contentType := "application/x-ndjson"
+	if b.opts.Encoding == JSONArray {
+		contentType = "application/json"
+		body.WriteByte('[')
+	}
+	for i, e := range batch {
+		if b.opts.Encoding == JSONArray {
+			if i > 0 {
+				body.WriteByte(',')
+			}
+			body.Write(e.data)
+		} else {
+			body.Write(e.data)
+			body.WriteByte('\n')
+		}
+	}
+	if b.opts.Encoding == JSONArray {
+		body.WriteByte(']')
+	}
+
+	req, err := b.opts.newRequest(b.url, contentType, &body)
+	if err != nil {
+		return err
+	}
+	_, err = doHTTP(b.opts.Client, req)
+	return err
+}
+
+func (o *HTTPOptions) setDefaults() {
+	if o.Formatter == nil {
+		o.Formatter = JSONFormatter
+	}
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+}
+
+// newRequest creates a POST request with the headers and authentication of
+// the options.
+func (o *HTTPOptions) newRequest(url, contentType string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range o.Header {
+		req.Header[k] = v
+	}
+	if o.Username != "" || o.Password != "" {
+		req.SetBasicAuth(o.Username, o.Password)
+	}
+	if o.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+o.BearerToken)
+	}
+	return req, nil
+}
+
+// doHTTP sends req and returns the body of a successful response. Network
+// errors, 5xx and 429 responses are returned as RetryableError, honoring the
+// Retry-After header.
+func doHTTP(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &RetryableError{Err: err}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, &RetryableError{Err: err}
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return body, nil
+	}
+
+	err = fmt.Errorf("logging: %s %s: %s: %s", req.Method, req.URL.Redacted(), resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, &RetryableError{Err: err, After: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	return nil, err
+}
+
+// parseRetryAfter parses the delay in seconds or the date of a Retry-After
+// header, zero if absent or invalid.
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,286 @@
+package logging
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ingester is a stand-in log ingestion endpoint recording the requests.
+type ingester struct {
+	mu       sync.Mutex
+	bodies   []string
+	requests []*http.Request
+	// status returns the status of the n-th request and sets headers.
+	status func(n int, w http.ResponseWriter) int
+}
+
+func (i *ingester) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	i.mu.Lock()
+	n := len(i.requests)
+	i.requests = append(i.requests, r)
+	i.bodies = append(i.bodies, string(body))
+	i.mu.Unlock()
+	if i.status != nil {
+		w.WriteHeader(i.status(n, w))
+	}
+}
+
+func (i *ingester) received() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]string(nil), i.bodies...)
+}
+
+func TestHTTPBackendBatchByCount(t *testing.T) {
+	InitForTesting(DEBUG)
+	ing := &ingester{}
+	ts := httptest.NewServer(ing)
+	defer ts.Close()
+
+	backend := NewHTTPBackend(ts.URL, HTTPOptions{
+		BatchOptions: BatchOptions{MaxRecords: 2, MaxLatency: time.Hour},
+		Formatter:    MustStringFormatter("%{level} %{message}"),
+		Header:       http.Header{"X-Source": {"test"}},
+		Username:     "user",
+		Password:     "secret",
+	})
+	log := MustGetLogger("test")
+	log.SetBackend(MultiLogger(backend))
+	log.Info("a")
+	log.Info("b")
+	log.Info("c")
+	waitFor(t, func() bool { return len(ing.received()) == 1 })
+	backend.Close()
+
+	bodies := ing.received()
+	if len(bodies) != 2 || bodies[0] != "INFO a\nINFO b\n" || bodies[1] != "INFO c\n" {
+		t.Errorf("unexpected bodies %q", bodies)
+	}
+	req := ing.requests[0]
+	if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "secret" {
+		t.Errorf("unexpected auth %q", req.Header.Get("Authorization"))
+	}
+	if req.Header.Get("X-Source") != "test" || req.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	if stats := backend.Stats(); stats.Sent != 3 || stats.Dropped != 0 || stats.Failed != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestHTTPBackendJSONArray(t *testing.T) {
+	InitForTesting(DEBUG)
+	ing := &ingester{}
+	ts := httptest.NewServer(ing)
+	defer ts.Close()
+
+	backend := NewHTTPBackend(ts.URL, HTTPOptions{
+		BatchOptions: BatchOptions{MaxLatency: 10 * time.Millisecond},
+		Encoding:     JSONArray,
+		BearerToken:  "token",
+	})
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("a")
+	log.Info("b")
+
+	// sent after the max latency, without flushing
+	waitFor(t, func() bool { return len(ing.received()) == 1 })
+	var records []map[string]interface{}
+	if err := json.Unmarshal([]byte(ing.received()[0]), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0]["message"] != "a" || records[1]["message"] != "b" {
+		t.Errorf("unexpected records %v", records)
+	}
+	if auth := ing.requests[0].Header.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("unexpected auth %q", auth)
+	}
+}
+
+func TestHTTPBackendRetry(t *testing.T) {
+	InitForTesting(DEBUG)
+	ing := &ingester{status: func(n int, w http.ResponseWriter) int {
+		switch n {
+		case 0:
+			return http.StatusServiceUnavailable
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			return http.StatusTooManyRequests
+		}
+		return http.StatusOK
+	}}
+	ts := httptest.NewServer(ing)
+	defer ts.Close()
+
+	backend := NewHTTPBackend(ts.URL, HTTPOptions{
+		BatchOptions: BatchOptions{MinBackoff: time.Millisecond},
+	})
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("a")
+	backend.Flush()
+
+	if bodies := ing.received(); len(bodies) != 3 || bodies[0] != bodies[2] {
+		t.Errorf("unexpected bodies %q", bodies)
+	}
+	if stats := backend.Stats(); stats.Sent != 1 || stats.Retries != 2 || stats.Failed != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	backend.Close()
+}
+
+func TestHTTPBackendRetryAfterCapped(t *testing.T) {
+	InitForTesting(DEBUG)
+	ing := &ingester{status: func(n int, w http.ResponseWriter) int {
+		if n == 0 {
+			w.Header().Set("Retry-After", "3600")
+			return http.StatusTooManyRequests
+		}
+		return http.StatusOK
+	}}
+	ts := httptest.NewServer(ing)
+	defer ts.Close()
+
+	backend := NewHTTPBackend(ts.URL, HTTPOptions{
+		BatchOptions: BatchOptions{MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+	})
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("a")
+	backend.Flush()
+
+	if stats := backend.Stats(); stats.Sent != 1 || stats.Retries != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestHTTPBackendCloseWhileRetrying(t *testing.T) {
+	InitForTesting(DEBUG)
+	ing := &ingester{status: func(n int, w http.ResponseWriter) int {
+		return http.StatusServiceUnavailable
+	}}
+	ts := httptest.NewServer(ing)
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var reported []error
+	SetErrorHandler(func(err error, rec *Record) {
+		mu.Lock()
+		reported = append(reported, err)
+		mu.Unlock()
+	})
+	defer SetErrorHandler(RateLimitedErrorHandler(os.Stderr, defaultErrorInterval))
+
+	backend := NewHTTPBackend(ts.URL, HTTPOptions{
+		BatchOptions: BatchOptions{MaxLatency: time.Millisecond, MinBackoff: time.Hour},
+	})
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("a")
+	waitFor(t, func() bool { return len(ing.received()) == 1 })
+
+	closed := make(chan struct{})
+	go func() {
+		backend.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by the retry backoff")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 {
+		t.Errorf("unexpected errors %v", reported)
+	}
+	if stats := backend.Stats(); stats.Failed != 1 || stats.Retries != 5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestHTTPBackendPermanentFailure(t *testing.T) {
+	InitForTesting(DEBUG)
+	ing := &ingester{status: func(n int, w http.ResponseWriter) int {
+		return http.StatusBadRequest
+	}}
+	ts := httptest.NewServer(ing)
+	defer ts.Close()
+
+	var reported []error
+	SetErrorHandler(func(err error, rec *Record) { reported = append(reported, err) })
+	defer SetErrorHandler(RateLimitedErrorHandler(os.Stderr, defaultErrorInterval))
+
+	backend := NewHTTPBackend(ts.URL, HTTPOptions{})
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("a")
+	backend.Close()
+
+	if len(ing.received()) != 1 {
+		t.Errorf("expected no retries, got %d requests", len(ing.received()))
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "400 Bad Request") {
+		t.Errorf("unexpected errors %v", reported)
+	}
+	if stats := backend.Stats(); stats.Failed != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestHTTPBackendBufferFull(t *testing.T) {
+	InitForTesting(DEBUG)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+
+	backend := NewHTTPBackend(ts.URL, HTTPOptions{
+		BatchOptions: BatchOptions{MaxRecords: 1, BufferSize: 1},
+	})
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	var errs []error
+	log.SetErrorHandler(func(err error, rec *Record) { errs = append(errs, err) })
+
+	log.Info("sending")
+	waitFor(t, func() bool { return len(backend.batch.in) == 0 })
+	log.Info("queued")
+	log.Info("dropped")
+	close(release)
+	backend.Close()
+
+	if len(errs) != 1 || errs[0] != ErrQueueFull {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if stats := backend.Stats(); stats.Sent != 2 || stats.Dropped != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("unexpected delay %v", d)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(date); d <= 50*time.Second || d > time.Minute {
+		t.Errorf("unexpected delay %v", d)
+	}
+	for _, s := range []string{"", "-1", "soon"} {
+		if d := parseRetryAfter(s); d != 0 {
+			t.Errorf("%q: unexpected delay %v", s, d)
+		}
+	}
+}
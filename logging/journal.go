@@ -0,0 +1,233 @@
+//+build linux
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// JournalSocket is the socket of the journald native protocol.
+const JournalSocket = "/run/systemd/journal/socket"
+
+// JournalBackend sends records to systemd-journald using its native protocol,
+// with the priority, the caller, the module and the fields of the record as
+// journal fields.
+type JournalBackend struct {
+	// Identifier is the SYSLOG_IDENTIFIER of the records.
+	Identifier string
+
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+// NewJournalBackend connects to journald. If identifier is not given, the name
+// of the launched command is used.
+func NewJournalBackend(identifier string) (*JournalBackend, error) {
+	return NewJournalBackendSocket(identifier, JournalSocket)
+}
+
+// NewJournalBackendSocket is the same as NewJournalBackend, but sends the
+// records to the socket at path.
+func NewJournalBackendSocket(identifier, path string) (*JournalBackend, error) {
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournalBackend{
+		Identifier: identifier,
+		conn:       conn,
+		addr:       &net.UnixAddr{Name: path, Net: "unixgram"},
+	}, nil
+}
+
+// Close closes the socket.
+func (b *JournalBackend) Close() error {
+	return b.conn.Close()
+}
+
+// Log implements the Backend interface.
+func (b *JournalBackend) Log(level Level, calldepth int, rec *Record) error {
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", rec.Formatted(calldepth+1))
+	writeJournalField(&buf, "PRIORITY", strconv.Itoa(int(level.Severity())))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", b.Identifier)
+	writeJournalField(&buf, "MODULE", rec.Module)
+	if frame, ok := rec.Caller(calldepth + 1); ok {
+		writeJournalField(&buf, "CODE_FILE", frame.File)
+		writeJournalField(&buf, "CODE_LINE", strconv.Itoa(frame.Line))
+		writeJournalField(&buf, "CODE_FUNC", frame.Function)
+	}
+
+	keys := make([]string, 0, len(rec.Fields))
+	for k := range rec.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if name := journalFieldName(k); name != "" {
+			writeJournalField(&buf, name, fmt.Sprint(rec.Fields[k]))
+		}
+	}
+	return b.send(buf.Bytes())
+}
+
+// send writes data as a datagram or, when too large for one, in a temporary
+// file whose descriptor is passed to journald.
+func (b *JournalBackend) send(data []byte) error {
+	_, _, err := b.conn.WriteMsgUnix(data, nil, b.addr)
+	if err == nil || !(errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)) {
+		return err
+	}
+
+	f, err := journalMemfd(data)
+	if err != nil {
+		if f, err = journalTempFile(data); err != nil {
+			return err
+		}
+	}
+	defer f.Close()
+	_, _, err = b.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), b.addr)
+	return err
+}
+
+// memfdCreate is the number of the memfd_create system call, which the
+// syscall package does not define on every architecture.
+var memfdCreate = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}
+
+// memfd_create flags and file seals, from linux/memfd.h and linux/fcntl.h.
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1033
+	sealAll         = 0x1 | 0x2 | 0x4 | 0x8 // seal, shrink, grow, write
+)
+
+// journalMemfd returns a sealed memfd holding data, the way journald prefers
+// large entries to be passed.
+func journalMemfd(data []byte) (*os.File, error) {
+	nr, ok := memfdCreate[runtime.GOARCH]
+	if !ok {
+		return nil, syscall.ENOSYS
+	}
+	name, err := syscall.BytePtrFromString("journal")
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(nr, uintptr(unsafe.Pointer(name)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	f := os.NewFile(fd, "journal")
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, sealAll); errno != 0 {
+		f.Close()
+		return nil, errno
+	}
+	return f, nil
+}
+
+// journalTempFile returns an unlinked file holding data, for kernels without
+// memfd_create. journald only accepts an unsealed file from /dev/shm, /tmp or
+// /var/tmp, so $TMPDIR is not used.
+func journalTempFile(data []byte) (f *os.File, err error) {
+	for _, dir := range []string{"/dev/shm", "/tmp", "/var/tmp"} {
+		if f, err = ioutil.TempFile(dir, "journal."); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeJournalField serializes a field, values with newlines are written with
+// their length instead of being terminated by a newline.
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.ContainsRune(value, '\n') {
+		buf.WriteString(name + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(name + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
+
+// journalReserved are the fields written by JournalBackend for every record.
+var journalReserved = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"MODULE":            true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// journalFieldName returns name as a valid journal field name: at most 64
+// upper case letters, digits and underscores, not starting with an underscore
+// nor a digit. An empty string is returned if nothing is left. Names of the
+// fields written by the backend are prefixed with "F_".
+func journalFieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	name = strings.TrimLeft(name, "_0123456789")
+	if journalReserved[name] {
+		name = "F_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
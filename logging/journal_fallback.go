@@ -0,0 +1,29 @@
+//+build !linux
+
+package logging
+
+import (
+	"fmt"
+)
+
+const JournalSocket = "/run/systemd/journal/socket"
+
+type JournalBackend struct {
+	Identifier string
+}
+
+func NewJournalBackend(identifier string) (*JournalBackend, error) {
+	return nil, fmt.Errorf("Platform does not support journald")
+}
+
+func NewJournalBackendSocket(identifier, path string) (*JournalBackend, error) {
+	return nil, fmt.Errorf("Platform does not support journald")
+}
+
+func (b *JournalBackend) Close() error {
+	return fmt.Errorf("Platform does not support journald")
+}
+
+func (b *JournalBackend) Log(level Level, calldepth int, rec *Record) error {
+	return fmt.Errorf("Platform does not support journald")
+}
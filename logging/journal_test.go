@@ -0,0 +1,204 @@
+//+build linux
+
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// readJournalEntry reads the next entry sent to conn, either inline or in a
+// passed file, and parses its fields.
+func readJournalEntry(t *testing.T, conn *net.UnixConn) map[string]string {
+	t.Helper()
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+	if oobn > 0 {
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "journal")
+		defer f.Close()
+		f.Seek(0, io.SeekStart)
+		if data, err = ioutil.ReadAll(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fields := make(map[string]string)
+	r := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return fields
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		line = line[:len(line)-1]
+		if i := strings.IndexByte(line, '='); i >= 0 {
+			fields[line[:i]] = line[i+1:]
+			continue
+		}
+		var size uint64
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			t.Fatal(err)
+		}
+		value := make([]byte, size+1)
+		if _, err := io.ReadFull(r, value); err != nil {
+			t.Fatal(err)
+		}
+		fields[line] = string(value[:size])
+	}
+}
+
+func newJournalStandIn(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, path
+}
+
+func TestJournalBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	conn, path := newJournalStandIn(t)
+	defer conn.Close()
+
+	backend, err := NewJournalBackendSocket("app", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+
+	log.WithFields(Fields{"request-id": 42, "_trusted": "x", "multi": "a\nb", "message": "spoofed"}).Error("query failed")
+	fields := readJournalEntry(t, conn)
+	expected := map[string]string{
+		"MESSAGE":           "query failed",
+		"PRIORITY":          "3",
+		"SYSLOG_IDENTIFIER": "app",
+		"MODULE":            "db",
+		"CODE_FILE":         fields["CODE_FILE"],
+		"CODE_LINE":         "98",
+		"CODE_FUNC":         "github.com/qjpcpu/log/logging.TestJournalBackend",
+		"REQUEST_ID":        "42",
+		"TRUSTED":           "x",
+		"MULTI":             "a\nb",
+		"F_MESSAGE":         "spoofed",
+	}
+	if len(fields) != len(expected) {
+		t.Errorf("unexpected fields %q", fields)
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, fields[k])
+		}
+	}
+	if filepath.Base(fields["CODE_FILE"]) != "journal_test.go" {
+		t.Errorf("unexpected file %q", fields["CODE_FILE"])
+	}
+}
+
+func TestJournalBackendLargeMessage(t *testing.T) {
+	InitForTesting(DEBUG)
+	conn, path := newJournalStandIn(t)
+	defer conn.Close()
+
+	backend, err := NewJournalBackendSocket("app", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+
+	msg := strings.Repeat("x", 1<<20)
+	log.Info(msg)
+	if fields := readJournalEntry(t, conn); fields["MESSAGE"] != msg {
+		t.Errorf("unexpected message of %d bytes", len(fields["MESSAGE"]))
+	}
+}
+
+func TestJournalFieldName(t *testing.T) {
+	for in, expected := range map[string]string{
+		"request-id": "REQUEST_ID",
+		"_pid":       "PID",
+		"2fa":        "FA",
+		"__":         "",
+		"Ünicode":    "NICODE",
+		"priority":   "F_PRIORITY",
+		"code-line":  "F_CODE_LINE",
+	} {
+		if got := journalFieldName(in); got != expected {
+			t.Errorf("%q: expected %q, got %q", in, expected, got)
+		}
+	}
+}
+
+func TestNewJournalBackendMissingSocket(t *testing.T) {
+	if _, err := NewJournalBackendSocket("app", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestJournalMemfd(t *testing.T) {
+	f, err := journalMemfd([]byte("MESSAGE=hi\n"))
+	if err == syscall.ENOSYS {
+		t.Skip("memfd_create not supported")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// F_GET_SEALS
+	seals, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), 1034, 0)
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	if seals != sealAll {
+		t.Errorf("expected seals %#x, got %#x", sealAll, seals)
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("expected sealed memfd to refuse writes")
+	}
+}
+
+func TestJournalTempFile(t *testing.T) {
+	os.Setenv("TMPDIR", t.TempDir())
+	defer os.Unsetenv("TMPDIR")
+	f, err := journalTempFile([]byte("MESSAGE=hi\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	name, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(int(f.Fd())))
+	if err != nil {
+		t.Skip(err)
+	}
+	if !strings.HasPrefix(name, "/dev/shm/") && !strings.HasPrefix(name, "/tmp/") && !strings.HasPrefix(name, "/var/tmp/") {
+		t.Errorf("unexpected temporary file %q", name)
+	}
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// JSONFormatter formats each record as a single line JSON object with the
+// keys time, level, module, file, message and fields.
+var JSONFormatter Formatter = &jsonFormatter{timeLayout: rfc3339Milli}
+
+// jsonFormatter is the Formatter behind JSONFormatter.
+type jsonFormatter struct {
+	timeLayout string
+}
+
+// jsonRecord is the JSON representation of a record.
+type jsonRecord struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Module  string `json:"module,omitempty"`
+	File    string `json:"file"`
+	Message string `json:"message"`
+	Fields  Fields `json:"fields,omitempty"`
+}
+
+// Format implements the Formatter interface.
+func (f *jsonFormatter) Format(calldepth int, r *Record, output io.Writer) error {
+	file := "???:0"
+	if frame, ok := r.Caller(calldepth + 1); ok {
+		file = fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+	}
+	data, err := json.Marshal(&jsonRecord{
+		Time:    r.Time.Format(f.timeLayout),
+		Level:   r.Level.Name(),
+		Module:  r.Module,
+		File:    file,
+		Message: r.Message(),
+		Fields:  r.Fields,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(data)
+	return err
+}
@@ -0,0 +1,32 @@
+package logging
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONFormatter(t *testing.T) {
+	backend := InitForTesting(DEBUG)
+	SetFormatter(JSONFormatter)
+
+	log := MustGetLogger("module")
+	log.Infof("hello %q", "world")
+
+	var rec map[string]string
+	line := MemoryRecordN(backend, 0).Formatted(0)
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		t.Fatalf("invalid json %s: %s", line, err)
+	}
+	expected := map[string]string{
+		"time":    "1970-01-01T00:00:00Z",
+		"level":   "info",
+		"module":  "module",
+		"file":    "json_test.go:16",
+		"message": `hello "world"`,
+	}
+	for k, v := range expected {
+		if rec[k] != v {
+			t.Errorf("unexpected %s: %q != %q", k, rec[k], v)
+		}
+	}
+}
@@ -5,9 +5,15 @@
 package logging
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // ErrInvalidLogLevel is used when an invalid log level has been used.
@@ -24,6 +30,7 @@ const (
 	NOTICE
 	INFO
 	DEBUG
+	TRACE
 )
 
 var levelNames = []string{
@@ -33,21 +40,220 @@ var levelNames = []string{
 	"NOTI",
 	"INFO",
 	"DEBU",
+	"TRAC",
 }
 
+// levelLongNames holds the full name of each level, indexed by level.
+var levelLongNames = []string{
+	"CRITICAL",
+	"ERROR",
+	"WARNING",
+	"NOTICE",
+	"INFO",
+	"DEBUG",
+	"TRACE",
+}
+
+// levelAliases are additional, commonly used, names accepted by ParseLevel.
+var levelAliases = map[string]Level{
+	"fatal": CRITICAL,
+	"panic": CRITICAL,
+	"crit":  CRITICAL,
+	"err":   ERROR,
+	"warn":  WARNING,
+}
+
+// Severity is a syslog severity, used to map log levels onto syslog
+// priorities.
+type Severity int
+
+// Syslog severities as defined by RFC 5424.
+const (
+	SeverityEmerg Severity = iota
+	SeverityAlert
+	SeverityCrit
+	SeverityErr
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+var (
+	// levelMu serializes RegisterLevel.
+	levelMu sync.Mutex
+
+	// levelRanks holds the position of each level, indexed by level, when all
+	// levels are ordered from the most to the least severe. Levels are compared
+	// by rank rather than by value so custom levels can be put anywhere.
+	levelRanks = []int{0, 1, 2, 3, 4, 5, 6}
+
+	// levelSeverities holds the syslog severity of each level.
+	levelSeverities = []Severity{
+		CRITICAL: SeverityCrit,
+		ERROR:    SeverityErr,
+		WARNING:  SeverityWarning,
+		NOTICE:   SeverityNotice,
+		INFO:     SeverityInfo,
+		DEBUG:    SeverityDebug,
+		TRACE:    SeverityDebug,
+	}
+)
+
 // String returns the string representation of a logging level.
 func (p Level) String() string {
+	if p < 0 || int(p) >= len(levelNames) {
+		return fmt.Sprintf("Level(%d)", int(p))
+	}
 	return levelNames[p]
 }
 
-// LogLevel returns the log level from a string representation.
-func LogLevel(level string) (Level, error) {
-	for i, name := range levelNames {
-		if strings.EqualFold(name, level) {
+// Severity returns the syslog severity the level maps to.
+func (p Level) Severity() Severity {
+	if p < 0 {
+		return SeverityEmerg
+	} else if int(p) >= len(levelSeverities) {
+		return SeverityDebug
+	}
+	return levelSeverities[p]
+}
+
+// rank returns the position of the level in the severity order. A lower rank
+// is more severe. Unknown levels sort by value around the known ones.
+func (p Level) rank() int {
+	if p < 0 {
+		return int(p)
+	} else if int(p) >= len(levelRanks) {
+		return len(levelRanks) + int(p)
+	}
+	return levelRanks[p]
+}
+
+// enabledAt returns true if records of level p pass a backend configured with
+// the given threshold level.
+func (p Level) enabledAt(threshold Level) bool {
+	return p.rank() <= threshold.rank()
+}
+
+// RegisterLevel adds a custom log level. The new level sorts directly below
+// the given level: it is less severe than below and more severe than the level
+// that used to follow below. Records of the new level are
+// mapped to severity when sent to syslog and are printed using the ANSI
+// color code col, eg. 34 for blue, when colors are enabled.
+//
+// RegisterLevel is not safe to use concurrently with logging and should be
+// called during program initialization.
+func RegisterLevel(name string, below Level, severity Severity, col int) (Level, error) {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return ERROR, errors.New("logger: empty level name")
+	}
+	if _, err := ParseLevel(name); err == nil {
+		return ERROR, errors.New("logger: level already registered: " + name)
+	}
+	if below < 0 || int(below) >= len(levelNames) {
+		return ERROR, ErrInvalidLogLevel
+	}
+	if severity < SeverityEmerg || severity > SeverityDebug {
+		return ERROR, fmt.Errorf("logger: invalid syslog severity %d", severity)
+	}
+
+	level := Level(len(levelNames))
+	rank := levelRanks[below] + 1
+	for i, r := range levelRanks {
+		if r >= rank {
+			levelRanks[i] = r + 1
+		}
+	}
+	levelRanks = append(levelRanks, rank)
+	levelNames = append(levelNames, name)
+	levelLongNames = append(levelLongNames, name)
+	levelSeverities = append(levelSeverities, severity)
+	addLevelColor(col)
+	return level, nil
+}
+
+// Name returns the full, lower case, name of a logging level, eg. "warning".
+func (p Level) Name() string {
+	if p < 0 || int(p) >= len(levelLongNames) {
+		return strconv.Itoa(int(p))
+	}
+	return strings.ToLower(levelLongNames[p])
+}
+
+// ParseLevel returns the log level from a string representation. Both the
+// full names, eg. "warning", and the short names, eg. "WARN", are accepted
+// regardless of case, as well as a few common aliases like "fatal" and "err"
+// and the numeric value of a level.
+func ParseLevel(level string) (Level, error) {
+	level = strings.TrimSpace(level)
+	for i := range levelNames {
+		if strings.EqualFold(levelNames[i], level) || strings.EqualFold(levelLongNames[i], level) {
 			return Level(i), nil
 		}
 	}
-	return ERROR, ErrInvalidLogLevel
+	if l, ok := levelAliases[strings.ToLower(level)]; ok {
+		return l, nil
+	}
+	if n, err := strconv.Atoi(level); err == nil && n >= 0 && n < len(levelNames) {
+		return Level(n), nil
+	}
+	return ERROR, fmt.Errorf("%w: %q", ErrInvalidLogLevel, level)
+}
+
+// LogLevel returns the log level from a string representation. It is the
+// same as ParseLevel.
+func LogLevel(level string) (Level, error) {
+	return ParseLevel(level)
+}
+
+// MarshalText implements encoding.TextMarshaler using the full level name.
+func (p Level) MarshalText() ([]byte, error) {
+	if p < 0 || int(p) >= len(levelNames) {
+		return nil, ErrInvalidLogLevel
+	}
+	return []byte(p.Name()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, see ParseLevel.
+func (p *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*p = level
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, levels are encoded by name.
+func (p Level) MarshalJSON() ([]byte, error) {
+	text, err := p.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Both level names and numeric
+// values are accepted.
+func (p *Level) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int
+		if json.Unmarshal(data, &n) != nil {
+			return err
+		}
+		s = strconv.Itoa(n)
+	}
+	return p.UnmarshalText([]byte(s))
+}
+
+// Set implements flag.Value, see ParseLevel.
+func (p *Level) Set(s string) error {
+	return p.UnmarshalText([]byte(s))
 }
 
 // Leveled interface is the interface required to be able to add leveled
@@ -55,6 +261,7 @@ func LogLevel(level string) (Level, error) {
 type Leveled interface {
 	GetLevel(string) Level
 	SetLevel(Level, string)
+	SetLevelRule(string, Level) error
 	IsEnabledFor(Level, string) bool
 }
 
@@ -66,47 +273,155 @@ type LeveledBackend interface {
 }
 
 type moduleLeveled struct {
-	levels    map[string]Level
+	// levels holds a *levelState which is never modified once stored. Any
+	// change replaces it with an updated copy, making reads lock-free.
+	levels    atomic.Value
+	mu        sync.Mutex
 	backend   Backend
 	formatter Formatter
 	once      sync.Once
 }
 
+// levelState is the level configuration of a moduleLeveled.
+type levelState struct {
+	levels map[string]Level
+	rules  []levelRule
+	// cache holds the level of modules resolved by rules, module -> Level.
+	cache *sync.Map
+}
+
+// levelRule sets the level of all modules matching a pattern.
+type levelRule struct {
+	pattern string
+	match   func(string) bool
+	level   Level
+}
+
+// CompileModulePattern returns a function reporting whether a module name
+// matches pattern. Patterns prefixed with "re:" are regular expressions, eg.
+// "re:^db\\.(pool|tx)$", any other pattern is a glob as supported by
+// path.Match, eg. "http.*".
+func CompileModulePattern(pattern string) (func(module string) bool, error) {
+	if strings.HasPrefix(pattern, "re:") {
+		re, err := regexp.Compile(pattern[len("re:"):])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("logger: invalid module pattern %q: %s", pattern, err)
+	}
+	return func(module string) bool {
+		ok, _ := path.Match(pattern, module)
+		return ok
+	}, nil
+}
+
 // AddModuleLevel wraps a log backend with knobs to have different log levels
 // for different modules.
 func AddModuleLevel(backend Backend) LeveledBackend {
 	var leveled LeveledBackend
 	var ok bool
 	if leveled, ok = backend.(LeveledBackend); !ok {
-		leveled = &moduleLeveled{
-			levels:  make(map[string]Level),
-			backend: backend,
-		}
+		leveled = newModuleLeveled(backend)
 	}
 	return leveled
 }
 
-// GetLevel returns the log level for the given module.
+func newModuleLeveled(backend Backend) *moduleLeveled {
+	l := &moduleLeveled{backend: backend}
+	l.levels.Store(&levelState{
+		levels: make(map[string]Level),
+		cache:  new(sync.Map),
+	})
+	return l
+}
+
+// GetLevel returns the log level for the given module. A level set for the
+// exact module name takes precedence over the first matching level rule.
 func (l *moduleLeveled) GetLevel(module string) Level {
-	level, exists := l.levels[module]
-	if exists == false {
-		level, exists = l.levels[""]
-		// no configuration exists, default to debug
+	state := l.levels.Load().(*levelState)
+	level, exists := state.levels[module]
+	if exists == false && len(state.rules) > 0 {
+		if cached, ok := state.cache.Load(module); ok {
+			return cached.(Level)
+		}
+		for _, rule := range state.rules {
+			if rule.match(module) {
+				level, exists = rule.level, true
+				break
+			}
+		}
 		if exists == false {
-			level = DEBUG
+			level = state.defaultLevel()
 		}
+		state.cache.Store(module, level)
+		return level
+	}
+	if exists == false {
+		level = state.defaultLevel()
+	}
+	return level
+}
+
+func (s *levelState) defaultLevel() Level {
+	level, exists := s.levels[""]
+	// no configuration exists, default to debug
+	if exists == false {
+		level = DEBUG
 	}
 	return level
 }
 
-// SetLevel sets the log level for the given module.
+// update replaces the level state with a modified copy.
+func (l *moduleLeveled) update(fn func(*levelState)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.levels.Load().(*levelState)
+	state := &levelState{
+		levels: make(map[string]Level, len(old.levels)+1),
+		rules:  append([]levelRule(nil), old.rules...),
+		cache:  new(sync.Map),
+	}
+	for k, v := range old.levels {
+		state.levels[k] = v
+	}
+	fn(state)
+	l.levels.Store(state)
+}
+
+// SetLevel sets the log level for the given module. It is safe to call while
+// other goroutines are logging.
 func (l *moduleLeveled) SetLevel(level Level, module string) {
-	l.levels[module] = level
+	l.update(func(state *levelState) {
+		state.levels[module] = level
+	})
+}
+
+// SetLevelRule sets the log level for all modules matching pattern, see
+// CompileModulePattern. Rules are evaluated in the order they were first set
+// and exact module names set with SetLevel take precedence.
+func (l *moduleLeveled) SetLevelRule(pattern string, level Level) error {
+	match, err := CompileModulePattern(pattern)
+	if err != nil {
+		return err
+	}
+	l.update(func(state *levelState) {
+		for i := range state.rules {
+			if state.rules[i].pattern == pattern {
+				state.rules[i].level = level
+				return
+			}
+		}
+		state.rules = append(state.rules, levelRule{pattern, match, level})
+	})
+	return nil
 }
 
 // IsEnabledFor will return true if logging is enabled for the given module.
 func (l *moduleLeveled) IsEnabledFor(level Level, module string) bool {
-	return level <= l.GetLevel(module)
+	return level.enabledAt(l.GetLevel(module))
 }
 
 func (l *moduleLeveled) Log(level Level, calldepth int, rec *Record) (err error) {
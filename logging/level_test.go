@@ -4,7 +4,14 @@
 
 package logging
 
-import "testing"
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
 
 func TestLevelString(t *testing.T) {
 	// Make sure all levels can be converted from string -> constant -> string
@@ -47,6 +54,71 @@ func TestLevelLogLevel(t *testing.T) {
 	}
 }
 
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		expected Level
+		level    string
+	}{
+		{CRITICAL, "critical"},
+		{CRITICAL, "fatal"},
+		{CRITICAL, "CRIT"},
+		{ERROR, "err"},
+		{ERROR, "ERRO"},
+		{WARNING, "warn"},
+		{NOTICE, " notice "},
+		{DEBUG, "DEBU"},
+		{TRACE, "trace"},
+		{INFO, "4"},
+	}
+	for _, test := range tests {
+		level, err := ParseLevel(test.level)
+		if err != nil {
+			t.Errorf("failed to parse %q: %s", test.level, err)
+		} else if level != test.expected {
+			t.Errorf("failed to parse %q: %s != %s", test.level, test.expected, level)
+		}
+	}
+
+	for _, invalid := range []string{"", "bla", "infoo", "-1", "1000"} {
+		if _, err := ParseLevel(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestLevelMarshal(t *testing.T) {
+	var config struct {
+		Level   Level `json:"level"`
+		Default Level `json:"default"`
+	}
+	if err := json.Unmarshal([]byte(`{"level":"warn","default":5}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Level != WARNING || config.Default != DEBUG {
+		t.Errorf("unexpected levels: %s %s", config.Level, config.Default)
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"level":"warning","default":"debug"}` {
+		t.Errorf("unexpected json: %s", data)
+	}
+	if err := json.Unmarshal([]byte(`{"level":"bla"}`), &config); err == nil {
+		t.Errorf("expected error for invalid level")
+	}
+
+	level := INFO
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(&level, "level", "log level")
+	if err := fs.Parse([]string{"-level", "error"}); err != nil {
+		t.Fatal(err)
+	}
+	if level != ERROR {
+		t.Errorf("unexpected flag level: %s", level)
+	}
+}
+
 func TestLevelModuleLevel(t *testing.T) {
 	backend := NewMemoryBackend(128)
 
@@ -74,3 +146,170 @@ func TestLevelModuleLevel(t *testing.T) {
 		}
 	}
 }
+
+func TestLevelTrace(t *testing.T) {
+	backend := NewMemoryBackend(128)
+
+	leveled := AddModuleLevel(backend)
+	leveled.SetLevel(DEBUG, "")
+	if leveled.IsEnabledFor(TRACE, "foo") {
+		t.Errorf("trace enabled at debug")
+	}
+	leveled.SetLevel(TRACE, "foo")
+	if !leveled.IsEnabledFor(TRACE, "foo") || !leveled.IsEnabledFor(DEBUG, "foo") {
+		t.Errorf("trace not enabled at trace")
+	}
+	if TRACE.Severity() != SeverityDebug {
+		t.Errorf("unexpected trace severity: %d", TRACE.Severity())
+	}
+}
+
+func registerTestLevel(t *testing.T, name string, below Level) Level {
+	if level, err := LogLevel(name); err == nil {
+		// already registered by a previous run of the test
+		return level
+	}
+	level, err := RegisterLevel(name, below, SeverityNotice, 34) // blue
+	if err != nil {
+		t.Fatalf("failed to register level: %v", err)
+	}
+	return level
+}
+
+func TestRegisterLevel(t *testing.T) {
+	audit := registerTestLevel(t, "AUDIT", WARNING)
+	security := registerTestLevel(t, "SECURITY", CRITICAL)
+
+	if audit.String() != "AUDIT" {
+		t.Errorf("unexpected name: %s", audit)
+	}
+	if level, err := LogLevel("audit"); err != nil || level != audit {
+		t.Errorf("failed to parse custom level: %v %v", level, err)
+	}
+	if audit.Severity() != SeverityNotice {
+		t.Errorf("unexpected severity: %d", audit.Severity())
+	}
+
+	order := []Level{CRITICAL, security, ERROR, WARNING, audit, NOTICE, INFO, DEBUG, TRACE}
+	for i := 1; i < len(order); i++ {
+		if !order[i-1].enabledAt(order[i]) || order[i].enabledAt(order[i-1]) {
+			t.Errorf("%s should be more severe than %s", order[i-1], order[i])
+		}
+	}
+
+	backend := NewMemoryBackend(128)
+	leveled := AddModuleLevel(backend)
+	leveled.SetLevel(WARNING, "")
+	log := MustGetLogger("test")
+	log.SetBackend(leveled)
+	log.Log(audit, "dropped")
+	log.Log(security, "kept")
+	if MemoryRecordN(backend, 0).Message() != "kept" || MemoryRecordN(backend, 1) != nil {
+		t.Errorf("unexpected records")
+	}
+
+	if _, err := RegisterLevel("audit", INFO, SeverityInfo, 0); err == nil {
+		t.Errorf("expected duplicate level error")
+	}
+	if _, err := RegisterLevel("foo", Level(1000), SeverityInfo, 0); err == nil {
+		t.Errorf("expected invalid level error")
+	}
+}
+
+// TestLevelModuleLevelConcurrent is mostly useful when run with -race.
+func TestLevelModuleLevelConcurrent(t *testing.T) {
+	leveled := AddModuleLevel(NewLogBackend(ioutil.Discard, "", 0))
+	leveled.SetLevel(INFO, "")
+
+	log := MustGetLogger("test")
+	log.SetBackend(leveled)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				log.Debug("debug")
+				leveled.IsEnabledFor(INFO, "test")
+				leveled.GetLevel("other")
+			}
+		}()
+	}
+
+	levels := []Level{ERROR, DEBUG, WARNING, TRACE}
+	for i := 0; i < 1000; i++ {
+		leveled.SetLevel(levels[i%len(levels)], "test")
+		leveled.SetLevel(levels[(i+1)%len(levels)], fmt.Sprintf("module%d", i%8))
+	}
+	close(done)
+	wg.Wait()
+
+	if leveled.GetLevel("test") != TRACE || leveled.GetLevel("module7") != ERROR {
+		t.Errorf("unexpected levels: %s %s", leveled.GetLevel("test"), leveled.GetLevel("module7"))
+	}
+}
+
+func TestLevelRule(t *testing.T) {
+	leveled := AddModuleLevel(NewMemoryBackend(128))
+	leveled.SetLevel(NOTICE, "")
+	leveled.SetLevel(DEBUG, "http.admin")
+	if err := leveled.SetLevelRule("http.*", WARNING); err != nil {
+		t.Fatal(err)
+	}
+	if err := leveled.SetLevelRule(`re:^db\.(pool|tx)$`, TRACE); err != nil {
+		t.Fatal(err)
+	}
+	if err := leveled.SetLevelRule("*", ERROR); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		level  Level
+		module string
+	}{
+		{NOTICE, ""},
+		{WARNING, "http.server"},
+		{DEBUG, "http.admin"},
+		{TRACE, "db.pool"},
+		{TRACE, "db.tx"},
+		{ERROR, "db.conn"},
+		{ERROR, "other"},
+	}
+	for i := 0; i < 2; i++ {
+		// second round is served from the cache
+		for _, e := range expected {
+			if actual := leveled.GetLevel(e.module); e.level != actual {
+				t.Errorf("unexpected level in %s: %s != %s", e.module, e.level, actual)
+			}
+		}
+	}
+
+	// updating a rule invalidates the cache and keeps the rule order
+	leveled.SetLevelRule("http.*", INFO)
+	if leveled.GetLevel("http.server") != INFO {
+		t.Errorf("updated rule not applied: %s", leveled.GetLevel("http.server"))
+	}
+	leveled.SetLevel(CRITICAL, "db.pool")
+	if leveled.GetLevel("db.pool") != CRITICAL {
+		t.Errorf("exact level not applied: %s", leveled.GetLevel("db.pool"))
+	}
+
+	for _, invalid := range []string{"[", "re:("} {
+		if err := leveled.SetLevelRule(invalid, DEBUG); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+
+	multi := MultiLogger(NewMemoryBackend(8), NewMemoryBackend(8))
+	multi.SetLevelRule("db.*", ERROR)
+	if multi.IsEnabledFor(WARNING, "db.tx") || !multi.IsEnabledFor(WARNING, "http") {
+		t.Errorf("rule not propagated by multi logger")
+	}
+}
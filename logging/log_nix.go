@@ -33,6 +33,7 @@ var (
 		WARNING:  ColorSeq(ColorYellow),
 		NOTICE:   ColorSeq(ColorGreen),
 		DEBUG:    ColorSeq(ColorCyan),
+		TRACE:    ColorSeq(ColorBlue),
 	}
 	boldcolors = []string{
 		CRITICAL: ColorSeqBold(ColorMagenta),
@@ -40,9 +41,30 @@ var (
 		WARNING:  ColorSeqBold(ColorYellow),
 		NOTICE:   ColorSeqBold(ColorGreen),
 		DEBUG:    ColorSeqBold(ColorCyan),
+		TRACE:    ColorSeqBold(ColorBlue),
 	}
 )
 
+// addLevelColor appends the color used by a newly registered level.
+func addLevelColor(col int) {
+	if col == 0 {
+		colors = append(colors, "")
+		boldcolors = append(boldcolors, "")
+		return
+	}
+	colors = append(colors, ColorSeq(color(col)))
+	boldcolors = append(boldcolors, ColorSeqBold(color(col)))
+}
+
+// levelColor returns the color of level in table, none if level is out of
+// range.
+func levelColor(table []string, level Level) string {
+	if level < 0 || int(level) >= len(table) {
+		return ""
+	}
+	return table[level]
+}
+
 // LogBackend utilizes the standard log module.
 type LogBackend struct {
 	Logger      *log.Logger
@@ -58,9 +80,9 @@ func NewLogBackend(out io.Writer, prefix string, flag int) *LogBackend {
 // Log implements the Backend interface.
 func (b *LogBackend) Log(level Level, calldepth int, rec *Record) error {
 	if b.Color {
-		col := colors[level]
-		if len(b.ColorConfig) > int(level) && b.ColorConfig[level] != "" {
-			col = b.ColorConfig[level]
+		col := levelColor(colors, level)
+		if c := levelColor(b.ColorConfig, level); c != "" {
+			col = c
 		}
 
 		buf := &bytes.Buffer{}
@@ -100,10 +122,10 @@ func ColorSeqBold(color color) string {
 
 func doFmtVerbLevelColor(layout string, level Level, output io.Writer) {
 	if layout == "bold" {
-		output.Write([]byte(boldcolors[level]))
+		output.Write([]byte(levelColor(boldcolors, level)))
 	} else if layout == "reset" {
 		output.Write([]byte("\033[0m"))
 	} else {
-		output.Write([]byte(colors[level]))
+		output.Write([]byte(levelColor(colors, level)))
 	}
 }
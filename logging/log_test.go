@@ -97,6 +97,21 @@ func BenchmarkLogChannelMemoryBackend(b *testing.B) {
 	channelBackend.Flush()
 }
 
+func TestLogBackendColorUnknownLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	colorizer := NewLogBackend(buf, "", 0)
+	colorizer.Color = true
+	SetBackend(colorizer)
+	SetFormatter(MustStringFormatter("%{color}%{color:bold}%{level} %{message}%{color:reset}"))
+
+	log := MustGetLogger("test")
+	log.Log(Level(-1), "below")
+	log.Log(Level(100), "above")
+	if !strings.Contains(buf.String(), "below") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
 func BenchmarkLogLeveled(b *testing.B) {
 	backend := SetBackend(NewLogBackend(ioutil.Discard, "", 0))
 	backend.SetLevel(INFO, "")
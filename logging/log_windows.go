@@ -43,6 +43,7 @@ var (
 		WARNING:  fgYellow,
 		NOTICE:   fgGreen,
 		DEBUG:    fgCyan,
+		TRACE:    fgBlue,
 	}
 	boldcolors = []uint16{
 		INFO:     fgWhite | fgIntensity,
@@ -51,9 +52,42 @@ var (
 		WARNING:  fgYellow | fgIntensity,
 		NOTICE:   fgGreen | fgIntensity,
 		DEBUG:    fgCyan | fgIntensity,
+		TRACE:    fgBlue | fgIntensity,
+	}
+
+	// ansiColors maps ANSI color codes, as given to RegisterLevel, to console
+	// character attributes.
+	ansiColors = map[int]uint16{
+		30: fgBlack,
+		31: fgRed,
+		32: fgGreen,
+		33: fgYellow,
+		34: fgBlue,
+		35: fgMagenta,
+		36: fgCyan,
+		37: fgWhite,
 	}
 )
 
+// addLevelColor appends the color used by a newly registered level.
+func addLevelColor(col int) {
+	attr, ok := ansiColors[col]
+	if !ok {
+		attr = fgWhite
+	}
+	colors = append(colors, attr)
+	boldcolors = append(boldcolors, attr|fgIntensity)
+}
+
+// levelColor returns the color of level in table, white if level is out of
+// range.
+func levelColor(table []uint16, level Level) uint16 {
+	if level < 0 || int(level) >= len(table) {
+		return fgWhite
+	}
+	return table[level]
+}
+
 type file interface {
 	Fd() uintptr
 }
@@ -84,7 +118,7 @@ func NewLogBackend(out io.Writer, prefix string, flag int) *LogBackend {
 func (b *LogBackend) Log(level Level, calldepth int, rec *Record) error {
 	if b.Color && b.f != nil {
 		buf := &bytes.Buffer{}
-		setConsoleTextAttribute(b.f, colors[level])
+		setConsoleTextAttribute(b.f, levelColor(colors, level))
 		buf.Write([]byte(rec.Formatted(calldepth + 1)))
 		err := b.Logger.Output(calldepth+2, buf.String())
 		setConsoleTextAttribute(b.f, fgWhite)
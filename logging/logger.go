@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"runtime"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -46,6 +48,7 @@ type Record struct {
 	Module string
 	Level  Level
 	Args   []interface{}
+	Fields Fields
 
 	// message is kept as a pointer to have shallow copies update this once
 	// needed.
@@ -53,6 +56,9 @@ type Record struct {
 	fmt       *string
 	formatter Formatter
 	formatted string
+	// pc is the program counter of the logging call, if it has been captured
+	// to be able to format the record away from the call, see captureCaller.
+	pc uintptr
 }
 
 // Formatted returns the formatted log record string.
@@ -65,6 +71,33 @@ func (r *Record) Formatted(calldepth int) string {
 	return r.formatted
 }
 
+// Caller returns the stack frame of the function which logged the record.
+// Unless the caller has been captured by a backend deferring the output of
+// the record, it is looked up on the stack using calldepth, in the same way as
+// for Formatted.
+func (r *Record) Caller(calldepth int) (runtime.Frame, bool) {
+	var pcs [1]uintptr
+	if r.pc != 0 {
+		pcs[0] = r.pc
+	} else if runtime.Callers(calldepth+2, pcs[:]) == 0 {
+		return runtime.Frame{}, false
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	return frame, frame.PC != 0
+}
+
+// captureCaller looks up and keeps the program counter of the logging call.
+// It should be called by backends which hand records over to be formatted
+// later or in another goroutine.
+func (r *Record) captureCaller(calldepth int) {
+	if r.pc == 0 {
+		var pcs [1]uintptr
+		if runtime.Callers(calldepth+2, pcs[:]) > 0 {
+			r.pc = pcs[0]
+		}
+	}
+}
+
 // Message returns the log record message.
 func (r *Record) Message() string {
 	if r.message == nil {
@@ -88,6 +121,28 @@ func (r *Record) Message() string {
 	return *r.message
 }
 
+// Fields are structured key/value pairs attached to records, see
+// Logger.WithFields. Fields are shared between records and must not be
+// modified once handed to a logger.
+type Fields map[string]interface{}
+
+// String returns the fields as space separated key=value pairs sorted by key.
+func (f Fields) String() string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&buf, "%s=%v", k, f[k])
+	}
+	return buf.String()
+}
+
 // Logger is the actual logger which creates log records based on the functions
 // called and passes them to the underlying logging backend.
 type Logger struct {
@@ -98,6 +153,10 @@ type Logger struct {
 	// ExtraCallDepth can be used to add additional call depth when getting the
 	// calling function. This is normally used when wrapping a logger.
 	ExtraCalldepth int
+
+	exitHandler  ExitHandler
+	errorHandler ErrorHandler
+	fields       Fields
 }
 
 // SetBackend overrides any previously defined backend for this logger.
@@ -106,6 +165,21 @@ func (l *Logger) SetBackend(backend LeveledBackend) {
 	l.haveBackend = true
 }
 
+// WithFields returns a copy of the logger which attaches the given fields,
+// merged with any fields of the logger itself, to every record.
+func (l *Logger) WithFields(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	l2 := *l
+	l2.fields = merged
+	return &l2
+}
+
 // TODO call NewLogger and remove MustGetLogger?
 
 // GetLogger creates and returns a Logger object based on the module name.
@@ -135,11 +209,26 @@ func Reset() {
 	timeNow = time.Now
 }
 
-// IsEnabledFor returns true if the logger is enabled for the given level.
+// IsEnabledFor returns true if the logger is enabled for the given level. The
+// backend set with SetBackend is used if there is one, otherwise the default
+// backend.
 func (l *Logger) IsEnabledFor(level Level) bool {
+	if l.haveBackend {
+		return l.backend.IsEnabledFor(level, l.Module)
+	}
 	return defaultBackend.IsEnabledFor(level, l.Module)
 }
 
+// Enabled is the same as IsEnabledFor. It can be used to guard expensive
+// computations only needed for a log record, eg.
+//
+//	if log.Enabled(logging.DEBUG) {
+//		log.Debugf("state: %s", dumpState())
+//	}
+func (l *Logger) Enabled(level Level) bool {
+	return l.IsEnabledFor(level)
+}
+
 func (l *Logger) log(lvl Level, format *string, args ...interface{}) {
 	if !l.IsEnabledFor(lvl) {
 		return
@@ -153,33 +242,38 @@ func (l *Logger) log(lvl Level, format *string, args ...interface{}) {
 		Level:  lvl,
 		fmt:    format,
 		Args:   args,
+		Fields: l.fields,
 	}
 
 	// TODO use channels to fan out the records to all backends?
-	// TODO in case of errors, do something (tricky)
 
 	// calldepth=2 brings the stack up to the caller of the level
 	// methods, Info(), Fatal(), etc.
 	// ExtraCallDepth allows this to be extended further up the stack in case we
 	// are wrapping these methods, eg. to expose them package level
+	var err error
 	if l.haveBackend {
-		l.backend.Log(lvl, 2+l.ExtraCalldepth, record)
-		return
+		err = l.backend.Log(lvl, 2+l.ExtraCalldepth, record)
+	} else {
+		err = defaultBackend.Log(lvl, 2+l.ExtraCalldepth, record)
+	}
+	if err != nil {
+		l.handleError(err, record)
 	}
-
-	defaultBackend.Log(lvl, 2+l.ExtraCalldepth, record)
 }
 
 // Fatal is equivalent to l.Critical(fmt.Sprint()) followed by a call to os.Exit(1).
+// The exit can be customized with SetExitHandler and PanicOnFatal.
 func (l *Logger) Fatal(args ...interface{}) {
 	l.log(CRITICAL, nil, args...)
-	os.Exit(1)
+	l.exit(fatalMessage(nil, args))
 }
 
 // Fatalf is equivalent to l.Critical followed by a call to os.Exit(1).
+// The exit can be customized with SetExitHandler and PanicOnFatal.
 func (l *Logger) Fatalf(format string, args ...interface{}) {
 	l.log(CRITICAL, &format, args...)
-	os.Exit(1)
+	l.exit(fatalMessage(&format, args))
 }
 
 // Panic is equivalent to l.Critical(fmt.Sprint()) followed by a call to panic().
@@ -254,6 +348,26 @@ func (l *Logger) Debugf(format string, args ...interface{}) {
 	l.log(DEBUG, &format, args...)
 }
 
+// Log logs a message using the given, possibly custom, log level.
+func (l *Logger) Log(level Level, args ...interface{}) {
+	l.log(level, nil, args...)
+}
+
+// Logf logs a message using the given, possibly custom, log level.
+func (l *Logger) Logf(level Level, format string, args ...interface{}) {
+	l.log(level, &format, args...)
+}
+
+// Trace logs a message using TRACE as log level.
+func (l *Logger) Trace(args ...interface{}) {
+	l.log(TRACE, nil, args...)
+}
+
+// Tracef logs a message using TRACE as log level.
+func (l *Logger) Tracef(format string, args ...interface{}) {
+	l.log(TRACE, &format, args...)
+}
+
 func init() {
 	Reset()
 }
@@ -60,3 +60,43 @@ func TestPrivateBackend(t *testing.T) {
 		t.Error("logged to defaultBackend:", MemoryRecordN(privateBackend, 0))
 	}
 }
+
+func TestPrivateBackendLevel(t *testing.T) {
+	InitForTesting(ERROR)
+	log := MustGetLogger("test")
+	privateBackend := NewMemoryBackend(10240)
+	lvlBackend := AddModuleLevel(privateBackend)
+	lvlBackend.SetLevel(DEBUG, "")
+	log.SetBackend(lvlBackend)
+
+	if !log.Enabled(DEBUG) || log.Enabled(TRACE) {
+		t.Errorf("private backend level not used")
+	}
+	log.Debug("to private backend")
+	if MemoryRecordN(privateBackend, 0) == nil {
+		t.Errorf("debug record dropped by default backend level")
+	}
+
+	// records dropped by the private backend are never created
+	lvlBackend.SetLevel(ERROR, "")
+	SetLevel(DEBUG, "")
+	seq := sequenceNo
+	log.Info("dropped")
+	if log.Enabled(INFO) || sequenceNo != seq {
+		t.Errorf("record created for disabled level")
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	backend := InitForTesting(DEBUG)
+	log := MustGetLogger("test").WithFields(Fields{"a": 1, "b": 2})
+	log.WithFields(Fields{"b": 3}).Info("with")
+	log.Info("without")
+
+	if f := MemoryRecordN(backend, 0).Fields; f.String() != "a=1 b=3" {
+		t.Errorf("unexpected fields: %s", f)
+	}
+	if f := MemoryRecordN(backend, 1).Fields; f.String() != "a=1 b=2" {
+		t.Errorf("unexpected fields: %s", f)
+	}
+}
@@ -0,0 +1,169 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Labels of the streams of a LokiBackend, other label names are taken from the
+// fields of the records.
+const (
+	LokiModule  = "module"
+	LokiLevel   = "level"
+	LokiProgram = "program"
+	LokiHost    = "host"
+)
+
+// lokiLabelName matches the characters not allowed in a label name.
+var lokiLabelName = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// LokiOptions configure a LokiBackend.
+type LokiOptions struct {
+	// HTTPOptions configure the requests and batches. The Encoding is
+	// ignored, records are formatted as the lines of the log entries.
+	HTTPOptions
+	// Labels are the labels grouping the records into streams: LokiModule,
+	// LokiLevel, LokiProgram, LokiHost or the name of a field. Records
+	// without the field do not have the label. They default to the module,
+	// the level, the program and the host.
+	Labels []string
+	// StaticLabels are added to all streams.
+	StaticLabels map[string]string
+	// TenantID is sent as X-Scope-OrgID to multi-tenant Loki servers.
+	TenantID string
+}
+
+// LokiBackend pushes records in batches to Grafana Loki.
+type LokiBackend struct {
+	url     string
+	opts    LokiOptions
+	program string
+	host    string
+	batch   *batcher
+}
+
+// lokiStream is a stream of the push API.
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// NewLokiBackend creates a LokiBackend pushing to the Loki server at url, eg.
+// "http://localhost:3100". Close should be called to send the pending records
+// before the program exits.
+func NewLokiBackend(url string, opts LokiOptions) *LokiBackend {
+	opts.setDefaults()
+	if opts.Labels == nil {
+		opts.Labels = []string{LokiModule, LokiLevel, LokiProgram, LokiHost}
+	}
+	host, _ := os.Hostname()
+	b := &LokiBackend{
+		url:     strings.TrimRight(url, "/") + "/loki/api/v1/push",
+		opts:    opts,
+		program: filepath.Base(os.Args[0]),
+		host:    host,
+	}
+	b.batch = newBatcher(opts.BatchOptions, b.send)
+	return b
+}
+
+// Log implements the Backend interface.
+func (b *LokiBackend) Log(level Level, calldepth int, rec *Record) error {
+	var buf bytes.Buffer
+	if err := b.opts.Formatter.Format(calldepth+1, rec, &buf); err != nil {
+		return err
+	}
+	return b.batch.add(rec, buf.Bytes())
+}
+
+// Flush sends the pending records and waits until they are sent.
+func (b *LokiBackend) Flush() {
+	b.batch.Flush()
+}
+
+// Close sends the pending records and stops the backend.
+func (b *LokiBackend) Close() {
+	b.batch.Close()
+}
+
+// Stats returns the number of records sent and dropped.
+func (b *LokiBackend) Stats() BatchStats {
+	return b.batch.Stats()
+}
+
+// labels returns the labels of the stream of rec.
+func (b *LokiBackend) labels(rec *Record) map[string]string {
+	labels := make(map[string]string, len(b.opts.StaticLabels)+len(b.opts.Labels))
+	for k, v := range b.opts.StaticLabels {
+		labels[k] = v
+	}
+	for _, name := range b.opts.Labels {
+		switch name {
+		case LokiModule:
+			labels[name] = rec.Module
+		case LokiLevel:
+			labels[name] = rec.Level.Name()
+		case LokiProgram:
+			labels[name] = b.program
+		case LokiHost:
+			labels[name] = b.host
+		default:
+			if v, ok := rec.Fields[name]; ok {
+				labels[lokiLabelName.ReplaceAllString(name, "_")] = fmt.Sprint(v)
+			}
+		}
+	}
+	return labels
+}
+
+func (b *LokiBackend) send(batch []batchEntry) error {
+	var streams []*lokiStream
+	index := make(map[string]*lokiStream)
+	for _, e := range batch {
+		labels := b.labels(e.rec)
+		key := lokiStreamKey(labels)
+		stream, ok := index[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			index[key] = stream
+			streams = append(streams, stream)
+		}
+		ts := strconv.FormatInt(e.rec.Time.UnixNano(), 10)
+		stream.Values = append(stream.Values, [2]string{ts, string(e.data)})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"streams": streams})
+	if err != nil {
+		return err
+	}
+	req, err := b.opts.newRequest(b.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if b.opts.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", b.opts.TenantID)
+	}
+	_, err = doHTTP(b.opts.Client, req)
+	return err
+}
+
+// lokiStreamKey returns a key identifying a label set.
+func lokiStreamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	for _, k := range keys {
+		buf.WriteString(strconv.Quote(k) + "=" + strconv.Quote(labels[k]) + ",")
+	}
+	return buf.String()
+}
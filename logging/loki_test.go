@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLokiBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 123456789, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	type push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]string        `json:"values"`
+		} `json:"streams"`
+	}
+	pushes := make(chan push, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" || r.Method != "POST" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Scope-OrgID") != "tenant" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		var p push
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("invalid payload: %s", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pushes <- p
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	backend := NewLokiBackend(ts.URL+"/", LokiOptions{
+		HTTPOptions: HTTPOptions{
+			Formatter: MustStringFormatter("%{message}"),
+		},
+		Labels:       []string{LokiModule, LokiLevel, LokiProgram, LokiHost, "tenant-id"},
+		StaticLabels: map[string]string{"env": "test"},
+		TenantID:     "tenant",
+	})
+	defer backend.Close()
+
+	db := MustGetLogger("db")
+	db.SetBackend(AddModuleLevel(backend))
+	web := MustGetLogger("http")
+	web.SetBackend(AddModuleLevel(backend))
+	db.Info("a")
+	web.Info("b")
+	db.WithFields(Fields{"tenant-id": 7}).Info("c")
+	db.Info("d")
+	backend.Flush()
+
+	p := <-pushes
+	host, _ := os.Hostname()
+	program := filepath.Base(os.Args[0])
+	labels := func(module string, extra ...string) map[string]string {
+		l := map[string]string{"module": module, "level": "info", "program": program, "host": host, "env": "test"}
+		for i := 0; i < len(extra); i += 2 {
+			l[extra[i]] = extra[i+1]
+		}
+		return l
+	}
+	ns := strconv.FormatInt(now.UnixNano(), 10)
+	expected := []struct {
+		labels map[string]string
+		lines  []string
+	}{
+		{labels("db"), []string{"a", "d"}},
+		{labels("http"), []string{"b"}},
+		{labels("db", "tenant_id", "7"), []string{"c"}},
+	}
+	if len(p.Streams) != len(expected) {
+		t.Fatalf("unexpected streams %+v", p.Streams)
+	}
+	for i, e := range expected {
+		s := p.Streams[i]
+		if len(s.Stream) != len(e.labels) {
+			t.Errorf("stream %d: unexpected labels %v", i, s.Stream)
+		}
+		for k, v := range e.labels {
+			if s.Stream[k] != v {
+				t.Errorf("stream %d: unexpected label %s=%q", i, k, s.Stream[k])
+			}
+		}
+		if len(s.Values) != len(e.lines) {
+			t.Fatalf("stream %d: unexpected values %v", i, s.Values)
+		}
+		for j, line := range e.lines {
+			if s.Values[j][0] != ns || s.Values[j][1] != line {
+				t.Errorf("stream %d: unexpected value %v", i, s.Values[j])
+			}
+		}
+	}
+	if stats := backend.Stats(); stats.Sent != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
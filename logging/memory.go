@@ -92,7 +92,7 @@ func (b *MemoryBackend) Log(level Level, calldepth int, rec *Record) error {
 		for {
 			headp := b.head
 			head := (*node)(b.head)
-			if head.next == nil {
+			if head == nil || head.next == nil {
 				break
 			}
 			swapped := atomic.CompareAndSwapPointer(
@@ -118,6 +118,32 @@ func (b *MemoryBackend) Head() *node {
 	return (*node)(b.head)
 }
 
+// Records returns a snapshot of the records kept in memory, oldest first.
+//
+// Note: records added while taking the snapshot may or may not be included.
+func (b *MemoryBackend) Records() []*Record {
+	return collectRecords(b.Head())
+}
+
+// Query returns the records kept in memory accepted by all predicates, oldest
+// first, eg. b.Query(LevelBetween(CRITICAL, ERROR), ModuleIn("db")).
+func (b *MemoryBackend) Query(preds ...Predicate) []*Record {
+	return filterRecords(b.Records(), preds)
+}
+
+// Len returns the number of records kept in memory.
+func (b *MemoryBackend) Len() int {
+	return int(atomic.LoadInt32(&b.size))
+}
+
+// Clear removes all records kept in memory. Records logged concurrently with
+// Clear may be dropped too.
+func (b *MemoryBackend) Clear() {
+	atomic.StorePointer(&b.head, nil)
+	atomic.StorePointer(&b.tail, nil)
+	atomic.StoreInt32(&b.size, 0)
+}
+
 type event int
 
 const (
@@ -136,6 +162,7 @@ type ChannelMemoryBackend struct {
 	running    bool
 	flushWg    sync.WaitGroup
 	stopWg     sync.WaitGroup
+	listMu     sync.RWMutex // guards head, tail and size
 	head, tail *node
 }
 
@@ -188,6 +215,9 @@ func (b *ChannelMemoryBackend) process() {
 }
 
 func (b *ChannelMemoryBackend) insertRecord(rec *Record) {
+	b.listMu.Lock()
+	defer b.listMu.Unlock()
+
 	prev := b.tail
 	b.tail = &node{Record: rec}
 	if prev == nil {
@@ -233,5 +263,58 @@ func (b *ChannelMemoryBackend) Log(level Level, calldepth int, rec *Record) erro
 // Note: new records can get added while iterating. Hence the number of records
 // iterated over might be larger than the maximum size.
 func (b *ChannelMemoryBackend) Head() *node {
+	b.listMu.RLock()
+	defer b.listMu.RUnlock()
 	return b.head
 }
+
+// Records returns a snapshot of the records kept in memory, oldest first.
+// Records still queued are not included, call Flush first to include them.
+func (b *ChannelMemoryBackend) Records() []*Record {
+	b.listMu.RLock()
+	defer b.listMu.RUnlock()
+	return collectRecords(b.head)
+}
+
+// Query returns the records kept in memory accepted by all predicates, oldest
+// first. Like Records, it does not include records still queued.
+func (b *ChannelMemoryBackend) Query(preds ...Predicate) []*Record {
+	return filterRecords(b.Records(), preds)
+}
+
+// Len returns the number of records kept in memory.
+func (b *ChannelMemoryBackend) Len() int {
+	b.listMu.RLock()
+	defer b.listMu.RUnlock()
+	return b.size
+}
+
+// Clear removes all records kept in memory. Records still queued are kept
+// and added once processed.
+func (b *ChannelMemoryBackend) Clear() {
+	b.listMu.Lock()
+	defer b.listMu.Unlock()
+	b.head, b.tail, b.size = nil, nil, 0
+}
+
+func collectRecords(n *node) []*Record {
+	var records []*Record
+	for ; n != nil; n = n.Next() {
+		records = append(records, n.Record)
+	}
+	return records
+}
+
+func filterRecords(records []*Record, preds []Predicate) []*Record {
+	if len(preds) == 0 {
+		return records
+	}
+	pred := And(preds...)
+	var filtered []*Record
+	for _, rec := range records {
+		if pred(rec) {
+			filtered = append(filtered, rec)
+		}
+	}
+	return filtered
+}
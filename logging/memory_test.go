@@ -5,8 +5,11 @@
 package logging
 
 import (
+	"bytes"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TODO share more code between these tests
@@ -115,3 +118,92 @@ func TestChannelMemoryBackend(t *testing.T) {
 		t.Errorf("unexpected eof: %s", record.Formatted(0))
 	}
 }
+
+func TestMemoryBackendQuery(t *testing.T) {
+	backend := InitForTesting(DEBUG)
+	SetFormatter(MustStringFormatter("%{level} %{module} %{message}"))
+	defer SetFormatter(DefaultFormatter)
+
+	start := time.Unix(100, 0).UTC()
+	for i := 0; i < 6; i++ {
+		now := start.Add(time.Duration(i) * time.Second)
+		timeNow = func() time.Time { return now }
+		log := MustGetLogger([]string{"db", "http"}[i%2])
+		if i%3 == 0 {
+			log.Errorf("failed %d", i)
+		} else {
+			log.Infof("request %d", i)
+		}
+	}
+
+	if backend.Len() != 6 || len(backend.Records()) != 6 {
+		t.Errorf("unexpected length: %d %d", backend.Len(), len(backend.Records()))
+	}
+	tests := []struct {
+		preds    []Predicate
+		expected []string
+	}{
+		{nil, []string{"failed 0", "request 1", "request 2", "failed 3", "request 4", "request 5"}},
+		{[]Predicate{LevelBetween(CRITICAL, ERROR)}, []string{"failed 0", "failed 3"}},
+		{[]Predicate{ModuleIn("db"), MessageContains("request")}, []string{"request 2", "request 4"}},
+		{[]Predicate{TimeBetween(start.Add(2*time.Second), start.Add(4*time.Second))}, []string{"request 2", "failed 3"}},
+		{[]Predicate{TimeBetween(time.Time{}, start.Add(time.Second))}, []string{"failed 0"}},
+	}
+	for i, test := range tests {
+		var actual []string
+		for _, rec := range backend.Query(test.preds...) {
+			actual = append(actual, rec.Message())
+		}
+		if strings.Join(actual, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("query %d: %v != %v", i, actual, test.expected)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ExportText(&buf, backend.Query(ModuleIn("http"), LevelBetween(ERROR, ERROR)), getFormatter()); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "ERRO http failed 3\n" {
+		t.Errorf("unexpected text export: %q", buf.String())
+	}
+	buf.Reset()
+	if err := ExportJSON(&buf, backend.Query(MessageContains("failed 0"))); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"id":1,"time":"1970-01-01T00:01:40Z","level":"error","module":"db","message":"failed 0"}`+"\n" {
+		t.Errorf("unexpected json export: %s", buf.String())
+	}
+
+	backend.Clear()
+	if backend.Len() != 0 || backend.Records() != nil {
+		t.Errorf("records not cleared")
+	}
+	MustGetLogger("db").Info("after clear")
+	if records := backend.Records(); len(records) != 1 || records[0].Message() != "after clear" {
+		t.Errorf("unexpected records after clear: %v", records)
+	}
+}
+
+func TestChannelMemoryBackendQuery(t *testing.T) {
+	backend := NewChannelMemoryBackend(8)
+	defer backend.Stop()
+
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	for i := 0; i < 10; i++ {
+		log.Infof("%d", i)
+	}
+	log.Error("error")
+	backend.Flush()
+
+	if backend.Len() != 8 || len(backend.Records()) != 8 {
+		t.Errorf("unexpected length: %d %d", backend.Len(), len(backend.Records()))
+	}
+	if records := backend.Query(LevelBetween(ERROR, CRITICAL)); len(records) != 1 || records[0].Message() != "error" {
+		t.Errorf("unexpected records: %v", records)
+	}
+	backend.Clear()
+	if backend.Len() != 0 || len(backend.Records()) != 0 {
+		t.Errorf("records not cleared")
+	}
+}
@@ -0,0 +1,361 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// msgpackEncoder writes the subset of MessagePack used by the Fluentd forward
+// protocol.
+type msgpackEncoder struct {
+	buf *bytes.Buffer
+}
+
+func (e msgpackEncoder) writeUint(prefix byte, size int, v uint64) {
+	e.buf.WriteByte(prefix)
+	for i := size - 1; i >= 0; i-- {
+		e.buf.WriteByte(byte(v >> (8 * uint(i))))
+	}
+}
+
+func (e msgpackEncoder) encodeNil() {
+	e.buf.WriteByte(0xc0)
+}
+
+func (e msgpackEncoder) encodeBool(v bool) {
+	if v {
+		e.buf.WriteByte(0xc3)
+	} else {
+		e.buf.WriteByte(0xc2)
+	}
+}
+
+func (e msgpackEncoder) encodeInt(v int64) {
+	switch {
+	case v >= 0:
+		e.encodeUint(uint64(v))
+	case v >= -32:
+		e.buf.WriteByte(byte(v))
+	case v >= math.MinInt8:
+		e.writeUint(0xd0, 1, uint64(v))
+	case v >= math.MinInt16:
+		e.writeUint(0xd1, 2, uint64(v))
+	case v >= math.MinInt32:
+		e.writeUint(0xd2, 4, uint64(v))
+	default:
+		e.writeUint(0xd3, 8, uint64(v))
+	}
+}
+
+func (e msgpackEncoder) encodeUint(v uint64) {
+	switch {
+	case v <= 0x7f:
+		e.buf.WriteByte(byte(v))
+	case v <= math.MaxUint8:
+		e.writeUint(0xcc, 1, v)
+	case v <= math.MaxUint16:
+		e.writeUint(0xcd, 2, v)
+	case v <= math.MaxUint32:
+		e.writeUint(0xce, 4, v)
+	default:
+		e.writeUint(0xcf, 8, v)
+	}
+}
+
+func (e msgpackEncoder) encodeFloat(v float64) {
+	e.writeUint(0xcb, 8, math.Float64bits(v))
+}
+
+func (e msgpackEncoder) encodeString(s string) {
+	switch n := len(s); {
+	case n <= 31:
+		e.buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.writeUint(0xd9, 1, uint64(n))
+	case n <= math.MaxUint16:
+		e.writeUint(0xda, 2, uint64(n))
+	default:
+		e.writeUint(0xdb, 4, uint64(n))
+	}
+	e.buf.WriteString(s)
+}
+
+func (e msgpackEncoder) encodeBytes(b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		e.writeUint(0xc4, 1, uint64(n))
+	case n <= math.MaxUint16:
+		e.writeUint(0xc5, 2, uint64(n))
+	default:
+		e.writeUint(0xc6, 4, uint64(n))
+	}
+	e.buf.Write(b)
+}
+
+func (e msgpackEncoder) encodeArrayHeader(n int) {
+	switch {
+	case n <= 15:
+		e.buf.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.writeUint(0xdc, 2, uint64(n))
+	default:
+		e.writeUint(0xdd, 4, uint64(n))
+	}
+}
+
+func (e msgpackEncoder) encodeMapHeader(n int) {
+	switch {
+	case n <= 15:
+		e.buf.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.writeUint(0xde, 2, uint64(n))
+	default:
+		e.writeUint(0xdf, 4, uint64(n))
+	}
+}
+
+// encodeEventTime writes t as the EventTime extension of the forward
+// protocol, with nanosecond precision.
+func (e msgpackEncoder) encodeEventTime(t time.Time) {
+	e.buf.WriteByte(0xd7)
+	e.buf.WriteByte(0x00)
+	var b [8]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	e.buf.Write(b[:])
+}
+
+// encode writes v, falling back to its string representation for types
+// without a MessagePack counterpart.
+func (e msgpackEncoder) encode(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		e.encodeNil()
+	case bool:
+		e.encodeBool(v)
+	case string:
+		e.encodeString(v)
+	case []byte:
+		e.encodeBytes(v)
+	case time.Time:
+		e.encodeString(v.Format(time.RFC3339Nano))
+	case error:
+		e.encodeString(v.Error())
+	case fmt.Stringer:
+		e.encodeString(v.String())
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.encodeMapHeader(len(keys))
+		for _, k := range keys {
+			e.encodeString(k)
+			e.encode(v[k])
+		}
+	case []interface{}:
+		e.encodeArrayHeader(len(v))
+		for _, item := range v {
+			e.encode(item)
+		}
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			e.encodeInt(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			e.encodeUint(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			e.encodeFloat(rv.Float())
+		default:
+			e.encodeString(fmt.Sprint(v))
+		}
+	}
+}
+
+// msgpackExt is a decoded MessagePack extension.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+var (
+	errMsgpackType     = errors.New("logging: unsupported msgpack type")
+	errMsgpackOverflow = errors.New("logging: msgpack integer overflows int64")
+	errMsgpackDepth    = errors.New("logging: msgpack value nested too deeply")
+)
+
+// msgpackMaxDepth limits the nesting of arrays and maps read from the peer,
+// the responses of a Fluentd server only use one level.
+const msgpackMaxDepth = 16
+
+// decodeMsgpack reads a single MessagePack value, as read from the responses
+// of a Fluentd server. Maps are decoded as map[string]interface{}, with keys
+// formatted as strings. Lengths are read from the peer, so memory is only
+// allocated for the bytes already received.
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	return decodeMsgpackValue(r, 0)
+}
+
+// decodeMsgpackValue reads a value nested in depth arrays or maps.
+func decodeMsgpackValue(r *bufio.Reader, depth int) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	readN := func(n uint64) ([]byte, error) {
+		if n <= uint64(r.Buffered()) {
+			b := make([]byte, n)
+			_, err := io.ReadFull(r, b)
+			return b, err
+		}
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	readUint := func(size uint64) (uint64, error) {
+		b, err := readN(size)
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		b, err := readN(uint64(c & 0x1f))
+		return string(b), err
+	case c&0xf0 == 0x90:
+		return decodeMsgpackArray(r, uint64(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return decodeMsgpackMap(r, uint64(c&0x0f), depth)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readUint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readN(n)
+	case 0xca:
+		v, err := readUint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := readUint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := readUint(1 << (c - 0xcc))
+		if err == nil && v > math.MaxInt64 {
+			err = errMsgpackOverflow
+		}
+		return int64(v), err
+	case 0xd0:
+		v, err := readUint(1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := readUint(2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := readUint(4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := readUint(8)
+		return int64(v), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		typ, err := readUint(1)
+		if err != nil {
+			return nil, err
+		}
+		data, err := readN(1 << (c - 0xd4))
+		return msgpackExt{int8(typ), data}, err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readUint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		b, err := readN(n)
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := readUint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackArray(r, n, depth)
+	case 0xde, 0xdf:
+		n, err := readUint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgpackMap(r, n, depth)
+	}
+	return nil, errMsgpackType
+}
+
+// msgpackCap returns the capacity to allocate for n elements, each taking
+// at least one of the bytes already received.
+func msgpackCap(r *bufio.Reader, n uint64) int {
+	if n > uint64(r.Buffered()) {
+		return r.Buffered()
+	}
+	return int(n)
+}
+
+func decodeMsgpackArray(r *bufio.Reader, n uint64, depth int) ([]interface{}, error) {
+	if depth++; depth > msgpackMaxDepth {
+		return nil, errMsgpackDepth
+	}
+	a := make([]interface{}, 0, msgpackCap(r, n))
+	for i := uint64(0); i < n; i++ {
+		v, err := decodeMsgpackValue(r, depth)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func decodeMsgpackMap(r *bufio.Reader, n uint64, depth int) (map[string]interface{}, error) {
+	if depth++; depth > msgpackMaxDepth {
+		return nil, errMsgpackDepth
+	}
+	m := make(map[string]interface{}, msgpackCap(r, n))
+	for i := uint64(0); i < n; i++ {
+		k, err := decodeMsgpackValue(r, depth)
+		if err != nil {
+			return nil, err
+		}
+		v, err := decodeMsgpackValue(r, depth)
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m, nil
+}
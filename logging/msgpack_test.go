@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMsgpackEncode(t *testing.T) {
+	cases := []struct {
+		v        interface{}
+		expected string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{1, "01"},
+		{-1, "ff"},
+		{-100, "d09c"},
+		{200, "ccc8"},
+		{70000, "ce00011170"},
+		{int64(-1) << 40, "d3ffffff0000000000"},
+		{1.5, "cb3ff8000000000000"},
+		{"abc", "a3616263"},
+		{strings.Repeat("a", 32), "d920" + strings.Repeat("61", 32)},
+		{[]byte{1, 2}, "c4020102"},
+		{[]interface{}{1, "a"}, "9201a161"},
+		{map[string]interface{}{"b": 2, "a": 1}, "82a16101a16202"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		msgpackEncoder{&buf}.encode(c.v)
+		if got := hex.EncodeToString(buf.Bytes()); got != c.expected {
+			t.Errorf("%v: expected %s, got %s", c.v, c.expected, got)
+		}
+	}
+}
+
+func TestMsgpackEventTime(t *testing.T) {
+	var buf bytes.Buffer
+	msgpackEncoder{&buf}.encodeEventTime(time.Unix(1, 2))
+	if got := hex.EncodeToString(buf.Bytes()); got != "d7000000000100000002" {
+		t.Errorf("unexpected event time %s", got)
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	v := map[string]interface{}{
+		"int":    int64(-70000),
+		"uint":   int64(1 << 40),
+		"float":  0.25,
+		"string": strings.Repeat("x", 300),
+		"bytes":  []byte("raw"),
+		"array":  []interface{}{nil, true, false},
+		"map":    map[string]interface{}{"k": "v"},
+	}
+	var buf bytes.Buffer
+	msgpackEncoder{&buf}.encode(v)
+	got, err := decodeMsgpack(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("unexpected value %v", got)
+	}
+}
+
+func TestMsgpackDecodeLarge(t *testing.T) {
+	s := strings.Repeat("x", 10000)
+	var buf bytes.Buffer
+	msgpackEncoder{&buf}.encode(s)
+	if got, err := decodeMsgpack(bufio.NewReader(&buf)); err != nil || got != s {
+		t.Errorf("unexpected value %.20q..., %v", got, err)
+	}
+}
+
+func TestMsgpackDecodeInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"str32":      "dbffffffff78",
+		"bin32":      "c6ffffffff78",
+		"array32":    "ddffffffff01",
+		"map32":      "dfffffffff0101",
+		"uint64":     "cf8000000000000000",
+		"nested":     strings.Repeat("91", 1<<20) + "01",
+		"nested map": strings.Repeat("8101", 1<<20) + "01",
+	} {
+		b, _ := hex.DecodeString(data)
+		if v, err := decodeMsgpack(bufio.NewReader(bytes.NewReader(b))); err == nil {
+			t.Errorf("%s: expected error, got %v", name, v)
+		}
+	}
+}
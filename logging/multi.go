@@ -21,26 +21,28 @@ func MultiLogger(backends ...Backend) LeveledBackend {
 	return &multiLogger{leveledBackends}
 }
 
-// Log passes the log record to all backends.
-func (b *multiLogger) Log(level Level, calldepth int, rec *Record) (err error) {
+// Log passes the log record to all backends. If more than one backend fails,
+// a MultiError holding all errors is returned.
+func (b *multiLogger) Log(level Level, calldepth int, rec *Record) error {
+	var errs MultiError
 	for _, backend := range b.backends {
 		if backend.IsEnabledFor(level, rec.Module) {
 			// Shallow copy of the record for the formatted cache on Record and get the
 			// record formatter from the backend.
 			r2 := *rec
 			if e := backend.Log(level, calldepth+1, &r2); e != nil {
-				err = e
+				errs = append(errs, e)
 			}
 		}
 	}
-	return
+	return errs.errorOrNil()
 }
 
 // GetLevel returns the highest level enabled by all backends.
 func (b *multiLogger) GetLevel(module string) Level {
 	var level Level
 	for _, backend := range b.backends {
-		if backendLevel := backend.GetLevel(module); backendLevel > level {
+		if backendLevel := backend.GetLevel(module); backendLevel.rank() > level.rank() {
 			level = backendLevel
 		}
 	}
@@ -54,6 +56,16 @@ func (b *multiLogger) SetLevel(level Level, module string) {
 	}
 }
 
+// SetLevelRule propagates the same level rule to all backends.
+func (b *multiLogger) SetLevelRule(pattern string, level Level) (err error) {
+	for _, backend := range b.backends {
+		if e := backend.SetLevelRule(pattern, level); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
 // IsEnabledFor returns true if any of the backends are enabled for it.
 func (b *multiLogger) IsEnabledFor(level Level, module string) bool {
 	for _, backend := range b.backends {
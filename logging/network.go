@@ -0,0 +1,462 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Framing defines how records are delimited on a stream connection.
+type Framing int
+
+// Framing methods, newline and octet counting as described in RFC 6587.
+const (
+	// NewlineFraming terminates each record with a newline.
+	NewlineFraming Framing = iota
+	// OctetCountingFraming prefixes each record with its length in bytes
+	// and a space.
+	OctetCountingFraming
+	// NullFraming terminates each record with a null byte, as expected by
+	// GELF over tcp.
+	NullFraming
+)
+
+var (
+	// ErrBufferFull is returned when a record is dropped because the peer is
+	// unreachable and there is no room left to keep it.
+	ErrBufferFull = errors.New("logging: network buffer full")
+
+	errClosed = errors.New("logging: log to closed backend")
+)
+
+// NetworkOptions configure a NetworkBackend.
+type NetworkOptions struct {
+	// TLSConfig enables TLS on tcp connections.
+	TLSConfig *tls.Config
+	// Framing delimits the records on tcp connections. Records sent over
+	// udp are sent one per datagram, without framing.
+	Framing Framing
+	// DialTimeout and WriteTimeout limit the time spent connecting to the
+	// peer and writing a record. They default to 5 seconds.
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	// MinBackoff and MaxBackoff bound the exponential backoff between
+	// reconnection attempts. They default to 100ms and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// BufferSize is the number of records kept in memory while the peer is
+	// unreachable. It defaults to 1024.
+	BufferSize int
+	// SpoolFile is a file the records are written to once the memory buffer
+	// is full. Records left in it by a previous run are sent first.
+	SpoolFile string
+	// MaxSpoolSize limits the size of the spool file in bytes, zero means
+	// no limit.
+	MaxSpoolSize int64
+}
+
+// NetworkBackend sends records to a collector over tcp, tcp with TLS or udp.
+// While the peer is unreachable, records are kept in memory and then in the
+// spool file and sent in order once reconnected.
+type NetworkBackend struct {
+	network string
+	addr    string
+	opts    NetworkOptions
+
+	mu        sync.Mutex
+	conn      net.Conn
+	pending   [][]byte
+	spool     *os.File
+	spoolOff  int64 // offset of the first record not sent yet
+	spoolSize int64
+	closed    bool
+	// reconnecting is set while a goroutine dials and replays, records are
+	// buffered meanwhile
+	reconnecting bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewNetworkBackend creates a NetworkBackend sending records to addr on the
+// given network, eg. "tcp" or "udp". Failing to connect is not an error, the
+// backend keeps trying in the background.
+func NewNetworkBackend(network, addr string, opts NetworkOptions) (*NetworkBackend, error) {
+	if opts.TLSConfig != nil && !strings.HasPrefix(network, "tcp") {
+		return nil, fmt.Errorf("logging: TLS not supported on %s", network)
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 5 * time.Second
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1024
+	}
+
+	b := &NetworkBackend{
+		network: network,
+		addr:    addr,
+		opts:    opts,
+		done:    make(chan struct{}),
+	}
+	if opts.SpoolFile != "" {
+		f, err := os.OpenFile(opts.SpoolFile, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		b.spool, b.spoolSize = f, fi.Size()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conn, err := b.dial()
+	switch {
+	case err != nil:
+		b.startReconnect(nil)
+	case b.spoolSize > 0:
+		b.startReconnect(conn)
+	default:
+		b.conn = conn
+	}
+	return b, nil
+}
+
+// Connected returns true if the backend is connected to its peer and has no
+// records left to send.
+func (b *NetworkBackend) Connected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conn != nil && len(b.pending) == 0 && b.spoolOff == b.spoolSize
+}
+
+// Log implements the Backend interface.
+func (b *NetworkBackend) Log(level Level, calldepth int, rec *Record) error {
+	return b.send(rec.Formatted(calldepth + 1))
+}
+
+// send frames and writes msg, or buffers it while the peer is unreachable.
+func (b *NetworkBackend) send(line string) error {
+	msg := b.frame(line)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errClosed
+	}
+	conn := b.conn
+	if conn == nil {
+		err := b.buffer(msg)
+		b.mu.Unlock()
+		return err
+	}
+	b.mu.Unlock()
+
+	n, err := b.write(conn, msg)
+	if err == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == conn {
+		b.disconnect()
+	}
+	if b.closed {
+		return errClosed
+	}
+	if n > 0 {
+		// The peer got a part of the record, sending it again would
+		// follow the truncated frame with a duplicate.
+		return err
+	}
+	return b.buffer(msg)
+}
+
+// Close stops reconnecting and closes the connection and the spool file.
+// Records not sent yet are moved to the spool file, to be sent first by the
+// next run, and are lost without one.
+func (b *NetworkBackend) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	b.mu.Unlock()
+	b.wg.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var err error
+	if b.conn != nil {
+		err = b.conn.Close()
+		b.conn = nil
+	}
+	if b.spool != nil {
+		if e := b.spill(); e != nil {
+			err = e
+		}
+		if e := b.spool.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (b *NetworkBackend) frame(msg string) []byte {
+	if isDatagram(b.network) {
+		return []byte(msg)
+	}
+	switch b.opts.Framing {
+	case OctetCountingFraming:
+		return []byte(strconv.Itoa(len(msg)) + " " + msg)
+	case NullFraming:
+		return []byte(msg + "\x00")
+	}
+	return []byte(msg + "\n")
+}
+
+// isDatagram reports whether network delimits the records itself.
+func isDatagram(network string) bool {
+	return strings.HasPrefix(network, "udp") || network == "unixgram"
+}
+
+func (b *NetworkBackend) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: b.opts.DialTimeout}
+	if b.opts.TLSConfig != nil {
+		return tls.DialWithDialer(dialer, b.network, b.addr, b.opts.TLSConfig)
+	}
+	return dialer.Dial(b.network, b.addr)
+}
+
+// write writes msg to conn and returns the number of bytes written.
+func (b *NetworkBackend) write(conn net.Conn, msg []byte) (int, error) {
+	if err := conn.SetWriteDeadline(time.Now().Add(b.opts.WriteTimeout)); err != nil {
+		return 0, err
+	}
+	return conn.Write(msg)
+}
+
+// disconnect closes the connection and starts reconnecting.
+func (b *NetworkBackend) disconnect() {
+	b.conn.Close()
+	b.conn = nil
+	b.startReconnect(nil)
+}
+
+// startReconnect replays the buffered records on conn, or on a new
+// connection if conn is nil, in the background.
+func (b *NetworkBackend) startReconnect(conn net.Conn) {
+	if b.closed || b.reconnecting {
+		if conn != nil {
+			conn.Close()
+		}
+		return
+	}
+	b.reconnecting = true
+	b.wg.Add(1)
+	go b.reconnect(conn)
+}
+
+func (b *NetworkBackend) reconnect(conn net.Conn) {
+	defer b.wg.Done()
+	backoff := b.opts.MinBackoff
+	for {
+		if conn != nil {
+			if err := b.replay(conn); err == nil {
+				return
+			}
+			conn.Close()
+			conn = nil
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-b.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if c, err := b.dial(); err == nil {
+			conn = c
+		}
+		if backoff *= 2; backoff > b.opts.MaxBackoff {
+			backoff = b.opts.MaxBackoff
+		}
+	}
+}
+
+// buffer keeps msg until the peer is reachable. Records go to memory first
+// and to the spool file once memory is full, keeping them in order.
+func (b *NetworkBackend) buffer(msg []byte) error {
+	if b.spoolOff == b.spoolSize && len(b.pending) < b.opts.BufferSize {
+		b.pending = append(b.pending, msg)
+		return nil
+	}
+	if b.spool == nil {
+		return ErrBufferFull
+	}
+	entry := spoolEntry(msg)
+	if b.opts.MaxSpoolSize > 0 && b.spoolSize+int64(len(entry)) > b.opts.MaxSpoolSize {
+		return ErrBufferFull
+	}
+	if _, err := b.spool.WriteAt(entry, b.spoolSize); err != nil {
+		// drop a partially written entry, it would be read as corrupted
+		b.spool.Truncate(b.spoolSize)
+		return err
+	}
+	b.spoolSize += int64(len(entry))
+	return nil
+}
+
+// spoolEntry returns msg as written to the spool file.
+func spoolEntry(msg []byte) []byte {
+	return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+}
+
+// spill moves the records kept in memory to the head of the spool file,
+// before the records spooled after them, within MaxSpoolSize.
+func (b *NetworkBackend) spill() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	rest := make([]byte, b.spoolSize-b.spoolOff)
+	if _, err := io.ReadFull(io.NewSectionReader(b.spool, b.spoolOff, int64(len(rest))), rest); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	var err error
+	for _, msg := range b.pending {
+		entry := spoolEntry(msg)
+		if b.opts.MaxSpoolSize > 0 && int64(buf.Len()+len(entry)+len(rest)) > b.opts.MaxSpoolSize {
+			err = ErrBufferFull
+			continue
+		}
+		buf.Write(entry)
+	}
+	buf.Write(rest)
+	b.pending = nil
+	if _, e := b.spool.WriteAt(buf.Bytes(), 0); e != nil {
+		return e
+	}
+	b.spoolOff, b.spoolSize = 0, int64(buf.Len())
+	if e := b.spool.Truncate(b.spoolSize); e != nil {
+		return e
+	}
+	return err
+}
+
+// replay sends the records kept in memory and then those in the spool file
+// on conn, and uses conn for the next records once none is left. The lock is
+// only held between records, the records logged meanwhile are buffered and
+// replayed after them.
+func (b *NetworkBackend) replay(conn net.Conn) error {
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return errClosed
+		}
+		msg, size, err := b.head()
+		if err != nil || msg == nil {
+			if err == nil {
+				b.conn, b.reconnecting = conn, false
+			}
+			b.mu.Unlock()
+			return err
+		}
+		b.mu.Unlock()
+
+		n, err := b.write(conn, msg)
+		if err != nil && n == 0 {
+			return err
+		}
+		// A partly written record is dropped with the connection rather
+		// than sent again.
+		b.mu.Lock()
+		e := b.pop(size)
+		b.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			return e
+		}
+	}
+}
+
+// head returns the next record to replay, and its size in the spool file or
+// zero if it is kept in memory. It returns a nil record if none is left.
+func (b *NetworkBackend) head() ([]byte, int64, error) {
+	if len(b.pending) > 0 {
+		return b.pending[0], 0, nil
+	}
+	if b.spool == nil || b.spoolOff == b.spoolSize {
+		return nil, 0, nil
+	}
+	r := bufio.NewReader(io.NewSectionReader(b.spool, b.spoolOff, b.spoolSize-b.spoolOff))
+	msg, n, err := readSpoolEntry(r)
+	if err != nil {
+		// A truncated or corrupted entry, eg. after a crash, can not be
+		// recovered and is skipped with the rest of the spool.
+		b.spoolOff, b.spoolSize = 0, 0
+		return nil, 0, b.spool.Truncate(0)
+	}
+	return msg, n, nil
+}
+
+// pop removes the record returned by head.
+func (b *NetworkBackend) pop(size int64) error {
+	if size == 0 {
+		b.pending[0] = nil
+		if b.pending = b.pending[1:]; len(b.pending) == 0 {
+			b.pending = nil
+		}
+		return nil
+	}
+	if b.spoolOff += size; b.spoolOff < b.spoolSize {
+		return nil
+	}
+	b.spoolOff, b.spoolSize = 0, 0
+	return b.spool.Truncate(0)
+}
+
+// readSpoolEntry reads a record written to the spool file and returns it with
+// the number of bytes read.
+func readSpoolEntry(r *bufio.Reader) ([]byte, int64, error) {
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := strconv.Atoi(prefix[:len(prefix)-1])
+	if err != nil || size < 0 {
+		return nil, 0, fmt.Errorf("logging: invalid spool entry %q", prefix)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, 0, err
+	}
+	return msg, int64(len(prefix) + size), nil
+}
@@ -0,0 +1,418 @@
+package logging
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// collector accepts connections on ln and sends the lines read to the
+// returned channel.
+func collector(t *testing.T, ln net.Listener) <-chan string {
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	return lines
+}
+
+func expectLines(t *testing.T, lines <-chan string, expected ...string) {
+	t.Helper()
+	for _, e := range expected {
+		select {
+		case line := <-lines:
+			if line != e {
+				t.Errorf("expected %q, got %q", e, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", e)
+		}
+	}
+}
+
+func TestNetworkBackendTCP(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := collector(t, ln)
+
+	backend, err := NewNetworkBackend("tcp", ln.Addr().String(), NetworkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+
+	log.Info("hello")
+	log.Info("world")
+	expectLines(t, lines, "hello", "world")
+}
+
+func TestNetworkBackendOctetCounting(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// without newlines, the records end up on the same line
+	lines := collector(t, ln)
+
+	backend, err := NewNetworkBackend("tcp", ln.Addr().String(), NetworkOptions{Framing: OctetCountingFraming})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("hello")
+	log.Info("hi\nworld")
+	backend.Close()
+
+	expectLines(t, lines, "5 hello8 hi", "world")
+}
+
+func TestNetworkBackendUDP(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	backend, err := NewNetworkBackend("udp", conn.LocalAddr().String(), NetworkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("hello")
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Errorf("unexpected datagram %q", buf[:n])
+	}
+}
+
+func TestNetworkBackendTLS(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	// borrow the certificate of a test HTTPS server
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", ts.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := collector(t, ln)
+
+	backend, err := NewNetworkBackend("tcp", ln.Addr().String(), NetworkOptions{
+		TLSConfig: ts.Client().Transport.(*http.Transport).TLSClientConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("secret")
+	expectLines(t, lines, "secret")
+
+	if _, err := NewNetworkBackend("udp", ln.Addr().String(), NetworkOptions{TLSConfig: &tls.Config{}}); err == nil {
+		t.Errorf("expected error for TLS over udp")
+	}
+}
+
+func TestNetworkBackendSpool(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	// reserve an address nobody listens on yet
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	spool := filepath.Join(t.TempDir(), "spool")
+	backend, err := NewNetworkBackend("tcp", addr, NetworkOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		BufferSize: 2,
+		SpoolFile:  spool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	var errs []error
+	log.SetErrorHandler(func(err error, rec *Record) { errs = append(errs, err) })
+
+	expected := []string{"a", "b", "c", "d", "e"}
+	for _, msg := range expected {
+		log.Info(msg)
+	}
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	if backend.Connected() {
+		t.Fatal("expected backend to be disconnected")
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("address reused: %v", err)
+	}
+	defer ln.Close()
+	lines := collector(t, ln)
+	expectLines(t, lines, expected...)
+
+	log.Info("f")
+	expectLines(t, lines, "f")
+}
+
+func TestNetworkBackendBufferFull(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	backend, err := NewNetworkBackend("tcp", addr, NetworkOptions{BufferSize: 1, MinBackoff: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	var errs []error
+	log.SetErrorHandler(func(err error, rec *Record) { errs = append(errs, err) })
+	log.Info("kept")
+	log.Info("dropped")
+	if len(errs) != 1 || errs[0] != ErrBufferFull {
+		t.Errorf("unexpected errors %v", errs)
+	}
+}
+
+func TestNetworkBackendCloseSpills(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	spool := filepath.Join(t.TempDir(), "spool")
+	opts := NetworkOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		BufferSize: 2,
+		SpoolFile:  spool,
+	}
+	backend, err := NewNetworkBackend("tcp", addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+
+	// a and b are kept in memory, c and d in the spool
+	expected := []string{"a", "b", "c", "d"}
+	for _, msg := range expected {
+		log.Info(msg)
+	}
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("address reused: %v", err)
+	}
+	defer ln.Close()
+	lines := collector(t, ln)
+	backend, err = NewNetworkBackend("tcp", addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	expectLines(t, lines, expected...)
+	waitFor(t, backend.Connected)
+}
+
+func TestNetworkBackendSpoolWriteError(t *testing.T) {
+	spool, err := os.OpenFile(filepath.Join(t.TempDir(), "spool"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &NetworkBackend{opts: NetworkOptions{BufferSize: 1}, spool: spool}
+	if err := b.buffer([]byte("a\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.buffer([]byte("b\n")); err != nil {
+		t.Fatal(err)
+	}
+	spool.Close()
+	if err := b.buffer([]byte("c\n")); err == nil {
+		t.Fatal("expected error writing to closed spool")
+	}
+	if b.spoolSize != 4 {
+		t.Errorf("unexpected spool size %d", b.spoolSize)
+	}
+}
+
+func TestNetworkBackendLogWhileReplaying(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	// a peer that never reads, the replay blocks until WriteTimeout
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	spool := filepath.Join(t.TempDir(), "spool")
+	line := []byte(strings.Repeat("x", 1<<20) + "\n")
+	var buf []byte
+	for i := 0; i < 16; i++ {
+		buf = append(buf, spoolEntry(line)...)
+	}
+	if err := ioutil.WriteFile(spool, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	backend, err := NewNetworkBackend("tcp", ln.Addr().String(), NetworkOptions{
+		WriteTimeout: 2 * time.Second,
+		MinBackoff:   time.Hour,
+		SpoolFile:    spool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	var errs []error
+	log.SetErrorHandler(func(err error, rec *Record) { errs = append(errs, err) })
+	log.Info("a")
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("logging blocked by the replay for %v", d)
+	}
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if backend.Connected() {
+		t.Error("expected backend to be replaying")
+	}
+}
+
+func TestNetworkBackendPartialWrite(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// the first connection is never read, the next ones send their first
+	// line
+	stalled := make(chan net.Conn, 1)
+	first := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		stalled <- conn
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				first <- strings.TrimSuffix(line, "\n")
+			}()
+		}
+	}()
+
+	backend, err := NewNetworkBackend("tcp", ln.Addr().String(), NetworkOptions{
+		WriteTimeout: 200 * time.Millisecond,
+		MinBackoff:   10 * time.Millisecond,
+		MaxBackoff:   20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	var errs []error
+	log.SetErrorHandler(func(err error, rec *Record) { errs = append(errs, err) })
+
+	log.Info(strings.Repeat("x", 16<<20))
+	if len(errs) != 1 {
+		t.Fatalf("expected the write to time out, got %v", errs)
+	}
+	conn := <-stalled
+	defer conn.Close()
+
+	log.Info("next")
+	select {
+	case line := <-first:
+		if line != "next" {
+			t.Errorf("expected %q, got %.20q", "next", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the next record")
+	}
+}
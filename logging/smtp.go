@@ -0,0 +1,390 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTPAuth is the authentication mechanism of an SMTPBackend.
+type SMTPAuth int
+
+// SMTP authentication mechanisms.
+const (
+	SMTPAuthPlain SMTPAuth = iota
+	SMTPAuthLogin
+)
+
+// ErrSMTPNoStartTLS is returned when STARTTLS is required but not supported by
+// the server.
+var ErrSMTPNoStartTLS = errors.New("logging: smtp server does not support STARTTLS")
+
+// SMTPOptions configure an SMTPBackend.
+type SMTPOptions struct {
+	// From and To are the sender and the recipients of the digests.
+	From string
+	To   []string
+	// Subject prefixes the subject of the digests, which ends with the
+	// number of records. It defaults to "[program@host]".
+	Subject string
+	// Username and Password authenticate with Auth, PLAIN by default, when
+	// Username is set.
+	Username string
+	Password string
+	Auth     SMTPAuth
+	// StartTLS requires the connection to be upgraded with STARTTLS, using
+	// TLSConfig if set.
+	StartTLS  bool
+	TLSConfig *tls.Config
+	// Timeout limits the time spent sending a digest. It defaults to 30
+	// seconds.
+	Timeout time.Duration
+	// Window is the time records are accumulated before sending a digest.
+	// It defaults to 5 minutes.
+	Window time.Duration
+	// MaxPerHour caps the number of digests sent per hour, records are
+	// accumulated until the next digest can be sent. It defaults to 10.
+	MaxPerHour int
+	// MaxEntries is the number of distinct messages listed in a digest,
+	// the other records are only counted. It defaults to 100.
+	MaxEntries int
+	// Formatter formats the first occurrence of each message. It defaults
+	// to the time, level, module, file, message and fields of the record.
+	Formatter Formatter
+	// Level is the lowest level of the records digested, the others are
+	// ignored. It defaults to ERROR.
+	Level *Level
+}
+
+// SMTPBackend emails digests of records, listing each distinct message with
+// its count and its first occurrence. It only digests the records at
+// SMTPOptions.Level or above, errors by default:
+//
+//	mail := NewSMTPBackend("smtp.example.com:587", opts)
+type SMTPBackend struct {
+	addr    string
+	opts    SMTPOptions
+	level   Level
+	program string
+	host    string
+
+	mu      sync.Mutex
+	digest  *smtpDigest
+	timer   *time.Timer
+	sent    []time.Time // times of the digests sent in the last hour
+	closed  bool
+	sending sync.Mutex // serializes sending the digests
+}
+
+// smtpDigest accumulates the records of a digest.
+type smtpDigest struct {
+	rec         Record // the first record, to report errors
+	first, last time.Time
+	count       int
+	other       int // records of the messages not listed
+	entries     []*smtpEntry
+	index       map[string]*smtpEntry
+}
+
+// smtpEntry is a distinct message of a digest.
+type smtpEntry struct {
+	level   Level
+	module  string
+	message string
+	first   string
+	count   int
+}
+
+var defaultSMTPFormatter = MustStringFormatter("%{time:2006-01-02 15:04:05.000} %{level} %{module} %{shortfile} %{message} %{fields}")
+
+// NewSMTPBackend creates an SMTPBackend sending through the server at addr, eg.
+// "smtp.example.com:587". Close should be called to send the pending records
+// before the program exits.
+func NewSMTPBackend(addr string, opts SMTPOptions) *SMTPBackend {
+	host, _ := os.Hostname()
+	program := filepath.Base(os.Args[0])
+	if opts.Subject == "" {
+		opts.Subject = "[" + program + "@" + host + "]"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.Window <= 0 {
+		opts.Window = 5 * time.Minute
+	}
+	if opts.MaxPerHour <= 0 {
+		opts.MaxPerHour = 10
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 100
+	}
+	if opts.Formatter == nil {
+		opts.Formatter = defaultSMTPFormatter
+	}
+	level := ERROR
+	if opts.Level != nil {
+		level = *opts.Level
+	}
+	return &SMTPBackend{addr: addr, opts: opts, level: level, program: program, host: host}
+}
+
+// Log implements the Backend interface.
+func (b *SMTPBackend) Log(level Level, calldepth int, rec *Record) error {
+	if level > b.level {
+		return nil
+	}
+	key := rec.Module + "\x00" + rec.Message()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return errClosed
+	}
+	d := b.digest
+	if d == nil {
+		d = &smtpDigest{rec: *rec, first: rec.Time, index: make(map[string]*smtpEntry)}
+		b.digest = d
+		b.timer = time.AfterFunc(b.opts.Window, b.timeout)
+	}
+	d.count++
+	d.last = rec.Time
+	if e, ok := d.index[key]; ok {
+		e.count++
+		return nil
+	}
+	if len(d.entries) >= b.opts.MaxEntries {
+		d.other++
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := b.opts.Formatter.Format(calldepth+1, rec, &buf); err != nil {
+		return err
+	}
+	e := &smtpEntry{
+		level:   rec.Level,
+		module:  rec.Module,
+		message: rec.Message(),
+		first:   strings.TrimSpace(buf.String()),
+		count:   1,
+	}
+	d.entries = append(d.entries, e)
+	d.index[key] = e
+	return nil
+}
+
+// Flush sends the pending digest, unless the hourly cap is reached.
+func (b *SMTPBackend) Flush() error {
+	_, err := b.send(false)
+	return err
+}
+
+// Close sends the pending digest, even if the hourly cap is reached, and
+// stops the backend.
+func (b *SMTPBackend) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	_, err := b.send(true)
+	return err
+}
+
+// timeout sends the digest at the end of its window.
+func (b *SMTPBackend) timeout() {
+	if rec, err := b.send(false); err != nil {
+		reportError(err, rec)
+	}
+}
+
+// send takes the pending digest and emails it, returning its first record.
+// When the hourly cap is reached, unless force is set, the digest is kept
+// until the next one can be sent. A digest failing to be sent is merged with
+// the records logged meanwhile, to be sent at the end of a new window.
+func (b *SMTPBackend) send(force bool) (*Record, error) {
+	b.sending.Lock()
+	defer b.sending.Unlock()
+
+	b.mu.Lock()
+	d := b.digest
+	if d == nil {
+		b.mu.Unlock()
+		return nil, nil
+	}
+	now := timeNow()
+	for len(b.sent) > 0 && now.Sub(b.sent[0]) >= time.Hour {
+		b.sent = b.sent[1:]
+	}
+	if !force && len(b.sent) >= b.opts.MaxPerHour {
+		if !b.closed {
+			b.timer.Reset(b.sent[0].Add(time.Hour).Sub(now))
+		}
+		b.mu.Unlock()
+		return nil, nil
+	}
+	b.timer.Stop()
+	b.digest = nil
+	b.mu.Unlock()
+
+	err := b.mail(b.message(d, now))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.sent = append(b.sent, now)
+		return &d.rec, nil
+	}
+	if b.digest != nil {
+		b.timer.Stop()
+		d.merge(b.digest, b.opts.MaxEntries)
+	}
+	b.digest = d
+	if !b.closed {
+		b.timer = time.AfterFunc(b.opts.Window, b.timeout)
+	}
+	return &d.rec, err
+}
+
+// merge adds the records of the later digest l to d.
+func (d *smtpDigest) merge(l *smtpDigest, maxEntries int) {
+	d.count += l.count
+	d.other += l.other
+	d.last = l.last
+	for _, e := range l.entries {
+		key := e.module + "\x00" + e.message
+		if de, ok := d.index[key]; ok {
+			de.count += e.count
+		} else if len(d.entries) < maxEntries {
+			d.entries = append(d.entries, e)
+			d.index[key] = e
+		} else {
+			d.other += e.count
+		}
+	}
+}
+
+// message returns the email of digest d.
+func (b *SMTPBackend) message(d *smtpDigest, now time.Time) []byte {
+	var msg bytes.Buffer
+	records := "records"
+	if d.count == 1 {
+		records = "record"
+	}
+	fmt.Fprintf(&msg, "From: %s\r\n", b.opts.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(b.opts.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s %d %s\r\n", b.opts.Subject, d.count, records)
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(&msg, "%d %s logged by %s on %s between %s and %s.\r\n",
+		d.count, records, b.program, b.host,
+		d.first.Format("2006-01-02 15:04:05"), d.last.Format("2006-01-02 15:04:05"))
+	for _, e := range d.entries {
+		fmt.Fprintf(&msg, "\r\n%dx %s %s: %s\r\n", e.count, e.level, e.module, e.message)
+		fmt.Fprintf(&msg, "  first: %s\r\n", e.first)
+	}
+	if d.other > 0 {
+		fmt.Fprintf(&msg, "\r\n%d other records not listed.\r\n", d.other)
+	}
+	return msg.Bytes()
+}
+
+// mail sends msg to the recipients.
+func (b *SMTPBackend) mail(msg []byte) error {
+	conn, err := net.DialTimeout("tcp", b.addr, b.opts.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(b.opts.Timeout)); err != nil {
+		return err
+	}
+	serverName, _, err := net.SplitHostPort(b.addr)
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, serverName)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if b.opts.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrSMTPNoStartTLS
+		}
+		config := b.opts.TLSConfig
+		if config == nil {
+			config = &tls.Config{ServerName: serverName}
+		}
+		if err := c.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if b.opts.Username != "" {
+		var auth smtp.Auth
+		if b.opts.Auth == SMTPAuthLogin {
+			auth = &loginAuth{b.opts.Username, b.opts.Password}
+		} else {
+			auth = smtp.PlainAuth("", b.opts.Username, b.opts.Password, serverName)
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(b.opts.From); err != nil {
+		return err
+	}
+	for _, to := range b.opts.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which net/smtp
+// does not provide.
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("logging: unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch prompt := strings.ToLower(string(fromServer)); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("logging: unexpected LOGIN prompt %q", fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
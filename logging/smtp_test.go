@@ -0,0 +1,388 @@
+package logging
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpMail is a mail received by smtpStandIn.
+type smtpMail struct {
+	from, auth string
+	to         []string
+	tls        bool
+	data       string
+}
+
+// smtpStandIn is a minimal SMTP server supporting STARTTLS if tlsConfig is
+// set, and the PLAIN and LOGIN authentications. It rejects the mails while
+// fail is set.
+type smtpStandIn struct {
+	ln        net.Listener
+	tlsConfig *tls.Config
+
+	mu    sync.Mutex
+	mails []smtpMail
+	fail  bool
+}
+
+func newSMTPStandIn(t *testing.T, tlsConfig *tls.Config) *smtpStandIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{ln: ln, tlsConfig: tlsConfig}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) received() []smtpMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMail(nil), s.mails...)
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	var mail smtpMail
+	text.PrintfLine("220 stand-in ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			cmd, arg = line[:i], line[i+1:]
+		}
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			text.PrintfLine("250-stand-in")
+			if s.tlsConfig != nil && !mail.tls {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN LOGIN")
+		case "STARTTLS":
+			text.PrintfLine("220 go ahead")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, text = tlsConn, textproto.NewConn(tlsConn)
+			mail.tls = true
+		case "AUTH":
+			mail.auth = s.auth(text, arg)
+			if mail.auth == "" {
+				text.PrintfLine("535 authentication failed")
+				continue
+			}
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			fail := s.fail
+			s.mu.Unlock()
+			if fail {
+				text.PrintfLine("451 try again later")
+				continue
+			}
+			mail.from = strings.TrimSuffix(strings.TrimPrefix(arg, "FROM:<"), ">")
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			mail.to = append(mail.to, strings.TrimSuffix(strings.TrimPrefix(arg, "TO:<"), ">"))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes() // lines end with \n
+			if err != nil {
+				return
+			}
+			mail.data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// auth returns "mechanism user:password", empty if the exchange failed.
+func (s *smtpStandIn) auth(text *textproto.Conn, arg string) string {
+	fields := strings.Fields(arg)
+	switch {
+	case len(fields) == 2 && fields[0] == "PLAIN":
+		b, err := base64.StdEncoding.DecodeString(fields[1])
+		parts := strings.Split(string(b), "\x00")
+		if err != nil || len(parts) != 3 {
+			return ""
+		}
+		return "PLAIN " + parts[1] + ":" + parts[2]
+	case len(fields) == 1 && fields[0] == "LOGIN":
+		var answers []string
+		for _, prompt := range []string{"Username:", "Password:"} {
+			text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+			line, err := text.ReadLine()
+			b, err2 := base64.StdEncoding.DecodeString(line)
+			if err != nil || err2 != nil {
+				return ""
+			}
+			answers = append(answers, string(b))
+		}
+		return "LOGIN " + strings.Join(answers, ":")
+	}
+	return ""
+}
+
+// selfSignedTLS returns the server and client configurations of a certificate
+// for 127.0.0.1.
+func selfSignedTLS(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	server = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	client = &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+	return server, client
+}
+
+func TestSMTPBackendDigest(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	serverTLS, clientTLS := selfSignedTLS(t)
+	standIn := newSMTPStandIn(t, serverTLS)
+	defer standIn.ln.Close()
+
+	backend := NewSMTPBackend(standIn.ln.Addr().String(), SMTPOptions{
+		From:      "app@example.com",
+		To:        []string{"oncall@example.com", "ops@example.com"},
+		Subject:   "[app]",
+		Username:  "user",
+		Password:  "secret",
+		StartTLS:  true,
+		TLSConfig: clientTLS,
+		Window:    time.Hour,
+		Formatter: MustStringFormatter("%{level} %{shortfile} %{message} %{fields}"),
+	})
+	mail := AddModuleLevel(backend)
+	mail.SetLevel(DEBUG, "")
+	log := MustGetLogger("db")
+	log.SetBackend(mail)
+
+	log.Warning("ignored")
+	log.WithFields(Fields{"host": "db1"}).Errorf("connection refused")
+	now = now.Add(time.Minute)
+	log.WithFields(Fields{"host": "db2"}).Errorf("connection refused")
+	log.Critical("corrupted")
+	if err := backend.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	mails := standIn.received()
+	if len(mails) != 1 {
+		t.Fatalf("unexpected mails %+v", mails)
+	}
+	m := mails[0]
+	if !m.tls || m.auth != "PLAIN user:secret" || m.from != "app@example.com" ||
+		strings.Join(m.to, ",") != "oncall@example.com,ops@example.com" {
+		t.Errorf("unexpected envelope %+v", m)
+	}
+	for _, expected := range []string{
+		"Subject: [app] 3 records\n",
+		"3 records logged by ",
+		" between 2024-03-01 10:20:30 and 2024-03-01 10:21:30.\n",
+		"\n2x ERRO db: connection refused\n  first: ERRO smtp_test.go:221 connection refused host=db1\n",
+		"\n1x CRIT db: corrupted\n",
+	} {
+		if !strings.Contains(m.data, expected) {
+			t.Errorf("%q not found in %q", expected, m.data)
+		}
+	}
+	if strings.Contains(m.data, "ignored") {
+		t.Errorf("warning sent in %q", m.data)
+	}
+}
+
+func TestSMTPBackendCap(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	standIn := newSMTPStandIn(t, nil)
+	defer standIn.ln.Close()
+
+	backend := NewSMTPBackend(standIn.ln.Addr().String(), SMTPOptions{
+		From:       "app@example.com",
+		To:         []string{"oncall@example.com"},
+		Username:   "user",
+		Password:   "secret",
+		Auth:       SMTPAuthLogin,
+		Window:     20 * time.Millisecond,
+		MaxPerHour: 1,
+		MaxEntries: 1,
+	})
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+
+	// sent at the end of the window
+	log.Error("first")
+	waitFor(t, func() bool { return len(standIn.received()) == 1 })
+
+	// capped until an hour after the first digest
+	log.Error("second")
+	log.Error("third")
+	if err := backend.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if mails := standIn.received(); len(mails) != 1 {
+		t.Fatalf("digest not capped: %+v", mails)
+	}
+	now = now.Add(time.Hour)
+	if err := backend.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	mails := standIn.received()
+	if len(mails) != 2 {
+		t.Fatalf("unexpected mails %+v", mails)
+	}
+	if mails[0].auth != "LOGIN user:secret" || mails[0].tls {
+		t.Errorf("unexpected envelope %+v", mails[0])
+	}
+	for _, expected := range []string{"1x ERRO db: second\n", "\n1 other records not listed.\n"} {
+		if !strings.Contains(mails[1].data, expected) {
+			t.Errorf("%q not found in %q", expected, mails[1].data)
+		}
+	}
+
+	log.Error("last")
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if mails := standIn.received(); len(mails) != 3 {
+		t.Errorf("last digest not sent on close: %d mails", len(mails))
+	}
+	if err := backend.Log(ERROR, 0, &Record{}); err != errClosed {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSMTPBackendRetry(t *testing.T) {
+	InitForTesting(DEBUG)
+	standIn := newSMTPStandIn(t, nil)
+	defer standIn.ln.Close()
+
+	backend := NewSMTPBackend(standIn.ln.Addr().String(), SMTPOptions{
+		From:       "app@example.com",
+		To:         []string{"oncall@example.com"},
+		Window:     time.Hour,
+		MaxPerHour: 1,
+	})
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+
+	standIn.mu.Lock()
+	standIn.fail = true
+	standIn.mu.Unlock()
+	log.Error("a")
+	if err := backend.Flush(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// kept with the records logged since, without using the hourly digest
+	log.Error("b")
+	log.Error("a")
+	standIn.mu.Lock()
+	standIn.fail = false
+	standIn.mu.Unlock()
+	if err := backend.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mails := standIn.received()
+	if len(mails) != 1 {
+		t.Fatalf("unexpected mails %+v", mails)
+	}
+	for _, expected := range []string{"3 records logged by ", "\n2x ERRO db: a\n", "\n1x ERRO db: b\n"} {
+		if !strings.Contains(mails[0].data, expected) {
+			t.Errorf("%q not found in %q", expected, mails[0].data)
+		}
+	}
+	backend.Close()
+}
+
+func TestSMTPBackendLevel(t *testing.T) {
+	InitForTesting(DEBUG)
+	standIn := newSMTPStandIn(t, nil)
+	defer standIn.ln.Close()
+
+	warning := WARNING
+	backend := NewSMTPBackend(standIn.ln.Addr().String(), SMTPOptions{
+		From:   "app@example.com",
+		To:     []string{"oncall@example.com"},
+		Window: time.Hour,
+		Level:  &warning,
+	})
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+
+	log.Info("ignored")
+	log.Warning("slow query")
+	log.Error("connection refused")
+	if err := backend.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	mails := standIn.received()
+	if len(mails) != 1 || !strings.Contains(mails[0].data, " 2 records\n") || strings.Contains(mails[0].data, "ignored") {
+		t.Errorf("unexpected mails %+v", mails)
+	}
+}
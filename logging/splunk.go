@@ -0,0 +1,229 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSplunkAckTimeout is returned when the indexers did not acknowledge a batch
+// in time, the batch is sent again.
+var ErrSplunkAckTimeout = errors.New("logging: splunk acknowledgement timed out")
+
+// SplunkOptions configure a SplunkBackend.
+type SplunkOptions struct {
+	// HTTPOptions configure the requests and batches. The Encoding and the
+	// Formatter are ignored, records are sent as HEC events.
+	HTTPOptions
+	// Token is the token of the HTTP Event Collector.
+	Token string
+	// Index, Source and SourceType are set on the events when not empty,
+	// SourceType defaults to the module of the record. Host defaults to
+	// the host name.
+	Index      string
+	Source     string
+	SourceType string
+	Host       string
+	// UseAck waits for the indexers to acknowledge each batch, polling
+	// every AckPollInterval, 1 second by default. Batches not acknowledged
+	// within AckTimeout, 1 minute by default, are sent again. Close stops
+	// waiting, the batches not acknowledged by then are reported with
+	// ErrSplunkAckTimeout. Channel identifies the client to the collector,
+	// a random one is used if empty.
+	UseAck          bool
+	AckPollInterval time.Duration
+	AckTimeout      time.Duration
+	Channel         string
+}
+
+// SplunkBackend sends records in batches to the Splunk HTTP Event Collector.
+// With acknowledgements, a batch is sent again if it is not acknowledged, so
+// records may be indexed twice.
+type SplunkBackend struct {
+	url    string
+	ackURL string
+	opts   SplunkOptions
+	batch  *batcher
+}
+
+// splunkEvent is the HEC event sent for a record.
+type splunkEvent struct {
+	Time       json.Number `json:"time"`
+	Host       string      `json:"host,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	SourceType string      `json:"sourcetype,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Event      struct {
+		Message  string `json:"message"`
+		Level    string `json:"level"`
+		Module   string `json:"module,omitempty"`
+		File     string `json:"file,omitempty"`
+		Line     int    `json:"line,omitempty"`
+		Function string `json:"function,omitempty"`
+		Fields   Fields `json:"fields,omitempty"`
+	} `json:"event"`
+}
+
+// NewSplunkBackend creates a SplunkBackend sending to the collector at url, eg.
+// "https://splunk:8088". Close should be called to send the pending records
+// before the program exits. An error is returned if no random channel can be
+// generated.
+func NewSplunkBackend(url string, opts SplunkOptions) (*SplunkBackend, error) {
+	opts.setDefaults()
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	if opts.AckPollInterval <= 0 {
+		opts.AckPollInterval = time.Second
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = time.Minute
+	}
+	if opts.Channel == "" {
+		var err error
+		if opts.Channel, err = newChannelID(); err != nil {
+			return nil, err
+		}
+	}
+	url = strings.TrimRight(url, "/")
+	b := &SplunkBackend{
+		url:    url + "/services/collector/event",
+		ackURL: url + "/services/collector/ack",
+		opts:   opts,
+	}
+	b.batch = newBatcher(opts.BatchOptions, b.send)
+	return b, nil
+}
+
+// newChannelID returns a random UUID.
+func newChannelID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[:4], id[4:6], id[6:8], id[8:10], id[10:]), nil
+}
+
+// Log implements the Backend interface.
+func (b *SplunkBackend) Log(level Level, calldepth int, rec *Record) error {
+	ev := &splunkEvent{
+		Time:       json.Number(fmt.Sprintf("%d.%03d", rec.Time.Unix(), rec.Time.Nanosecond()/1e6)),
+		Host:       b.opts.Host,
+		Source:     b.opts.Source,
+		SourceType: b.opts.SourceType,
+		Index:      b.opts.Index,
+	}
+	if ev.SourceType == "" {
+		ev.SourceType = rec.Module
+	}
+	ev.Event.Message = rec.Message()
+	ev.Event.Level = rec.Level.Name()
+	ev.Event.Module = rec.Module
+	ev.Event.Fields = rec.Fields
+	if frame, ok := rec.Caller(calldepth + 1); ok {
+		ev.Event.File, ev.Event.Line, ev.Event.Function = frame.File, frame.Line, frame.Function
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return b.batch.add(rec, data)
+}
+
+// Flush sends the pending records and waits until they are sent.
+func (b *SplunkBackend) Flush() {
+	b.batch.Flush()
+}
+
+// Close sends the pending records and stops the backend.
+func (b *SplunkBackend) Close() {
+	b.batch.Close()
+}
+
+// Stats returns the number of records sent and dropped.
+func (b *SplunkBackend) Stats() BatchStats {
+	return b.batch.Stats()
+}
+
+func (b *SplunkBackend) send(batch []batchEntry) error {
+	var body bytes.Buffer
+	for _, e := range batch {
+		body.Write(e.data)
+		body.WriteByte('\n')
+	}
+	data, err := b.post(b.url, &body)
+	if err != nil {
+		return err
+	}
+	if !b.opts.UseAck {
+		return nil
+	}
+
+	var resp struct {
+		AckID *uint64 `json:"ackId"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("logging: invalid splunk response: %s", err)
+	}
+	if resp.AckID == nil {
+		return errors.New("logging: splunk response without ackId, acknowledgement is disabled for the token")
+	}
+	return b.waitAck(*resp.AckID)
+}
+
+// waitAck polls the acknowledgement of id until it is indexed or AckTimeout
+// elapses. Once the backend is closing, it polls at once and gives up if the
+// batch is not acknowledged yet, rather than sending it again.
+func (b *SplunkBackend) waitAck(id uint64) error {
+	query, _ := json.Marshal(map[string][]uint64{"acks": {id}})
+	deadline := time.Now().Add(b.opts.AckTimeout)
+	for {
+		closing := false
+		timer := time.NewTimer(b.opts.AckPollInterval)
+		select {
+		case <-timer.C:
+		case <-b.batch.stop:
+			timer.Stop()
+			closing = true
+		}
+		data, err := b.post(b.ackURL, bytes.NewReader(query))
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return fmt.Errorf("logging: invalid splunk ack response: %s", err)
+		}
+		if resp.Acks[strconv.FormatUint(id, 10)] {
+			return nil
+		}
+		if closing {
+			return ErrSplunkAckTimeout
+		}
+		if time.Now().After(deadline) {
+			return &RetryableError{Err: ErrSplunkAckTimeout}
+		}
+	}
+}
+
+// post sends body to url with the token and the channel of the backend.
+func (b *SplunkBackend) post(url string, body io.Reader) ([]byte, error) {
+	req, err := b.opts.newRequest(url, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Splunk "+b.opts.Token)
+	req.Header.Set("X-Splunk-Request-Channel", b.opts.Channel)
+	return doHTTP(b.opts.Client, req)
+}
@@ -0,0 +1,204 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hecStandIn is a stand-in HTTP Event Collector acknowledging the batches
+// after pending polls, never if pending is negative.
+type hecStandIn struct {
+	mu      sync.Mutex
+	events  []map[string]interface{}
+	batches int
+	polls   int
+	pending int
+	channel string
+}
+
+func (s *hecStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Splunk token" || r.Method != "POST" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channel = r.Header.Get("X-Splunk-Request-Channel")
+
+	switch r.URL.Path {
+	case "/services/collector/event":
+		dec := json.NewDecoder(bufio.NewReader(r.Body))
+		for dec.More() {
+			var ev map[string]interface{}
+			if err := dec.Decode(&ev); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.events = append(s.events, ev)
+		}
+		s.batches++
+		fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, s.batches)
+	case "/services/collector/ack":
+		var query struct {
+			Acks []int `json:"acks"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil || len(query.Acks) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.polls++
+		fmt.Fprintf(w, `{"acks":{"%d":%t}}`, query.Acks[0], s.pending >= 0 && s.polls > s.pending)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSplunkBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 123456789, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	standIn := &hecStandIn{pending: 1}
+	ts := httptest.NewServer(standIn)
+	defer ts.Close()
+
+	backend, err := NewSplunkBackend(ts.URL, SplunkOptions{
+		Token:           "token",
+		Index:           "main",
+		Source:          "test",
+		Host:            "web1",
+		UseAck:          true,
+		AckPollInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := MustGetLogger("db")
+	db.SetBackend(AddModuleLevel(backend))
+	db.WithFields(Fields{"rows": 3}).Info("query")
+	backend.Flush()
+	backend.Close()
+
+	if len(standIn.events) != 1 || standIn.polls != 2 {
+		t.Fatalf("unexpected events %v after %d polls", standIn.events, standIn.polls)
+	}
+	ev := standIn.events[0]
+	expected := map[string]interface{}{
+		"time":       1709288430.123,
+		"host":       "web1",
+		"source":     "test",
+		"sourcetype": "db",
+		"index":      "main",
+	}
+	for k, v := range expected {
+		if ev[k] != v {
+			t.Errorf("unexpected %s: %v != %v", k, ev[k], v)
+		}
+	}
+	event, _ := ev["event"].(map[string]interface{})
+	if event["message"] != "query" || event["level"] != "info" || event["module"] != "db" ||
+		event["function"] != "github.com/qjpcpu/log/logging.TestSplunkBackend" {
+		t.Errorf("unexpected event %v", event)
+	}
+	if fields, _ := event["fields"].(map[string]interface{}); fields["rows"] != float64(3) {
+		t.Errorf("unexpected fields %v", event["fields"])
+	}
+	if len(standIn.channel) != 36 {
+		t.Errorf("unexpected channel %q", standIn.channel)
+	}
+	if stats := backend.Stats(); stats.Sent != 1 || stats.Retries != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSplunkBackendAckTimeout(t *testing.T) {
+	InitForTesting(DEBUG)
+	standIn := &hecStandIn{pending: -1}
+	ts := httptest.NewServer(standIn)
+	defer ts.Close()
+
+	var reported []error
+	SetErrorHandler(func(err error, rec *Record) { reported = append(reported, err) })
+	defer SetErrorHandler(RateLimitedErrorHandler(os.Stderr, defaultErrorInterval))
+
+	backend, err := NewSplunkBackend(ts.URL, SplunkOptions{
+		HTTPOptions: HTTPOptions{
+			BatchOptions: BatchOptions{MaxRetries: 1, MinBackoff: time.Millisecond},
+		},
+		Token:           "token",
+		SourceType:      "app",
+		UseAck:          true,
+		AckPollInterval: time.Millisecond,
+		AckTimeout:      5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("lost")
+	backend.Flush()
+	backend.Close()
+
+	if standIn.batches != 2 || len(standIn.events) != 2 || standIn.events[0]["sourcetype"] != "app" {
+		t.Errorf("unexpected events %v in %d batches", standIn.events, standIn.batches)
+	}
+	if stats := backend.Stats(); stats.Failed != 1 || stats.Retries != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrSplunkAckTimeout) {
+		t.Errorf("unexpected errors %v", reported)
+	}
+}
+
+func TestSplunkBackendCloseWhileWaitingAck(t *testing.T) {
+	InitForTesting(DEBUG)
+	standIn := &hecStandIn{pending: -1}
+	ts := httptest.NewServer(standIn)
+	defer ts.Close()
+
+	var reported []error
+	SetErrorHandler(func(err error, rec *Record) { reported = append(reported, err) })
+	defer SetErrorHandler(RateLimitedErrorHandler(os.Stderr, defaultErrorInterval))
+
+	backend, err := NewSplunkBackend(ts.URL, SplunkOptions{
+		HTTPOptions: HTTPOptions{
+			BatchOptions: BatchOptions{MaxRetries: 1, MaxLatency: time.Millisecond},
+		},
+		Token:           "token",
+		UseAck:          true,
+		AckPollInterval: time.Hour,
+		AckTimeout:      time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("unacknowledged")
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	backend.Close()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Close waited %v for the acknowledgement", d)
+	}
+	if standIn.batches != 1 {
+		t.Errorf("unexpected %d batches", standIn.batches)
+	}
+	if stats := backend.Stats(); stats.Failed != 1 || stats.Retries != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], ErrSplunkAckTimeout) {
+		t.Errorf("unexpected errors %v", reported)
+	}
+}
@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SQLColumns are the columns a SQLBackend writes records to. Empty columns
+// are not written. Like the table, they are written unquoted in the queries
+// and must be identifiers, optionally qualified with dots.
+type SQLColumns struct {
+	// Time is the time of the record.
+	Time string
+	// Level is the name of the level, eg. "error".
+	Level string
+	// Module is the module of the record.
+	Module string
+	// Message is the formatted message.
+	Message string
+	// Caller is the file and line of the logging call, eg. "main.go:42".
+	Caller string
+	// Fields are the fields of the record as a JSON object, NULL if there
+	// are none.
+	Fields string
+}
+
+// SQLOptions configure a SQLBackend.
+type SQLOptions struct {
+	BatchOptions
+	// Table is the table records are inserted into, "logs" by default.
+	Table string
+	// Columns maps the records to the columns of the table. It defaults to
+	// columns named time, level, module, message, caller and fields.
+	Columns SQLColumns
+	// Placeholder returns the placeholder of the nth parameter of a query,
+	// starting at 1. It defaults to "?", DollarPlaceholder suits
+	// PostgreSQL.
+	Placeholder func(n int) string
+	// IsTransient reports whether an insert failing with err is retried. By
+	// default bad connections, network errors and timeouts are retried.
+	IsTransient func(err error) bool
+}
+
+// DollarPlaceholder returns the placeholders of PostgreSQL, eg. "$1".
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// SQLBackend inserts records in batches into a table through database/sql,
+// with one multi-row insert per batch.
+type SQLBackend struct {
+	db      *sql.DB
+	opts    SQLOptions
+	columns []string
+	batch   *batcher
+}
+
+// sqlIdentifier matches the table and column names accepted by a SQLBackend.
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// NewSQLBackend creates a SQLBackend inserting into db, which is left open by
+// Close. Close should be called to insert the pending records before the
+// program exits. An error is returned if the table or a column is not a valid
+// identifier.
+func NewSQLBackend(db *sql.DB, opts SQLOptions) (*SQLBackend, error) {
+	if opts.Table == "" {
+		opts.Table = "logs"
+	}
+	if opts.Columns == (SQLColumns{}) {
+		opts.Columns = SQLColumns{
+			Time:    "time",
+			Level:   "level",
+			Module:  "module",
+			Message: "message",
+			Caller:  "caller",
+			Fields:  "fields",
+		}
+	}
+	if opts.Placeholder == nil {
+		opts.Placeholder = func(int) string { return "?" }
+	}
+	if opts.IsTransient == nil {
+		opts.IsTransient = isTransientSQLError
+	}
+	if !sqlIdentifier.MatchString(opts.Table) {
+		return nil, fmt.Errorf("logging: invalid SQL table %q", opts.Table)
+	}
+	b := &SQLBackend{db: db, opts: opts}
+	for _, column := range []string{
+		opts.Columns.Time,
+		opts.Columns.Level,
+		opts.Columns.Module,
+		opts.Columns.Message,
+		opts.Columns.Caller,
+		opts.Columns.Fields,
+	} {
+		if column == "" {
+			continue
+		}
+		if !sqlIdentifier.MatchString(column) {
+			return nil, fmt.Errorf("logging: invalid SQL column %q", column)
+		}
+		b.columns = append(b.columns, column)
+	}
+	b.batch = newBatcher(opts.BatchOptions, b.send)
+	return b, nil
+}
+
+// isTransientSQLError reports whether err is a bad connection, a network error
+// or a timeout.
+func isTransientSQLError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr)
+}
+
+// Log implements the Backend interface.
+func (b *SQLBackend) Log(level Level, calldepth int, rec *Record) error {
+	var data []byte
+	if b.opts.Columns.Fields != "" && len(rec.Fields) > 0 {
+		var err error
+		if data, err = json.Marshal(rec.Fields); err != nil {
+			return err
+		}
+	}
+	size := len(data) + len(rec.Message())
+	if b.opts.Columns.Caller != "" {
+		rec.captureCaller(calldepth + 1)
+	}
+	return b.batch.addSized(rec, data, size)
+}
+
+// Flush inserts the pending records and waits until they are inserted.
+func (b *SQLBackend) Flush() {
+	b.batch.Flush()
+}
+
+// Close inserts the pending records and stops the backend.
+func (b *SQLBackend) Close() {
+	b.batch.Close()
+}
+
+// Stats returns the number of records inserted and dropped.
+func (b *SQLBackend) Stats() BatchStats {
+	return b.batch.Stats()
+}
+
+// values returns the values of the columns of e.
+func (b *SQLBackend) values(e batchEntry) []interface{} {
+	var values []interface{}
+	c := b.opts.Columns
+	if c.Time != "" {
+		values = append(values, e.rec.Time)
+	}
+	if c.Level != "" {
+		values = append(values, e.rec.Level.Name())
+	}
+	if c.Module != "" {
+		values = append(values, e.rec.Module)
+	}
+	if c.Message != "" {
+		values = append(values, e.rec.Message())
+	}
+	if c.Caller != "" {
+		var caller interface{}
+		if frame, ok := e.rec.Caller(0); ok && e.rec.pc != 0 {
+			caller = fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+		values = append(values, caller)
+	}
+	if c.Fields != "" {
+		var fields interface{}
+		if e.data != nil {
+			fields = string(e.data)
+		}
+		values = append(values, fields)
+	}
+	return values
+}
+
+func (b *SQLBackend) send(batch []batchEntry) error {
+	var query strings.Builder
+	fmt.Fprintf(&query, "INSERT INTO %s (%s) VALUES ", b.opts.Table, strings.Join(b.columns, ", "))
+	args := make([]interface{}, 0, len(batch)*len(b.columns))
+	for i, e := range batch {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteByte('(')
+		for j, v := range b.values(e) {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			args = append(args, v)
+			query.WriteString(b.opts.Placeholder(len(args)))
+		}
+		query.WriteByte(')')
+	}
+
+	if _, err := b.db.Exec(query.String(), args...); err != nil {
+		if b.opts.IsTransient(err) {
+			return &RetryableError{Err: err}
+		}
+		return err
+	}
+	return nil
+}
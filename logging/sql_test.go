@@ -0,0 +1,240 @@
+package logging
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver is a database/sql driver recording the statements executed and
+// failing with the errors queued in fail.
+type fakeDriver struct {
+	mu    sync.Mutex
+	execs []fakeExec
+	fail  []error
+}
+
+type fakeExec struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+
+func (d *fakeDriver) executed() []fakeExec {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]fakeExec(nil), d.execs...)
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c.d, query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if len(s.d.fail) > 0 {
+		err := s.d.fail[0]
+		s.d.fail = s.d.fail[1:]
+		return nil, err
+	}
+	s.d.execs = append(s.d.execs, fakeExec{s.query, args})
+	return driver.RowsAffected(int64(strings.Count(s.query, "("))), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("queries not supported")
+}
+
+var (
+	fakeDriverMu  sync.Mutex
+	fakeDriverSeq int
+)
+
+// openFakeDB registers a new fakeDriver and opens it.
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDriver) {
+	fakeDriverMu.Lock()
+	fakeDriverSeq++
+	name := "logging-fake-" + strconv.Itoa(fakeDriverSeq)
+	fakeDriverMu.Unlock()
+	d := &fakeDriver{}
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, d
+}
+
+// transientError is retried by the tests.
+type transientError struct{}
+
+func (transientError) Error() string { return "deadlock detected" }
+
+func TestSQLBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	db, d := openFakeDB(t)
+	defer db.Close()
+	d.fail = []error{transientError{}}
+
+	backend, err := NewSQLBackend(db, SQLOptions{
+		BatchOptions: BatchOptions{MinBackoff: time.Millisecond},
+		Table:        "audit",
+		Placeholder:  DollarPlaceholder,
+		IsTransient: func(err error) bool {
+			return errors.Is(err, transientError{})
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+	log.WithFields(Fields{"user": "bob"}).Info("login")
+	log.Warning("logout")
+	backend.Close()
+
+	execs := d.executed()
+	if len(execs) != 1 {
+		t.Fatalf("unexpected statements %+v", execs)
+	}
+	query := "INSERT INTO audit (time, level, module, message, caller, fields) VALUES ($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12)"
+	if execs[0].query != query {
+		t.Errorf("unexpected query %q", execs[0].query)
+	}
+	expected := []driver.Value{
+		now, "info", "db", "login", "sql_test.go:131", `{"user":"bob"}`,
+		now, "warning", "db", "logout", "sql_test.go:132", nil,
+	}
+	args := execs[0].args
+	if len(args) != len(expected) {
+		t.Fatalf("unexpected arguments %v", args)
+	}
+	for i := range expected {
+		if args[i] != expected[i] {
+			t.Errorf("argument %d: %v != %v", i+1, args[i], expected[i])
+		}
+	}
+	if stats := backend.Stats(); stats.Sent != 2 || stats.Retries != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSQLBackendColumns(t *testing.T) {
+	InitForTesting(DEBUG)
+	db, d := openFakeDB(t)
+	defer db.Close()
+	d.fail = []error{errors.New("no such table: logs")}
+
+	var reported []error
+	SetErrorHandler(func(err error, rec *Record) { reported = append(reported, err) })
+	defer SetErrorHandler(RateLimitedErrorHandler(os.Stderr, defaultErrorInterval))
+
+	backend, err := NewSQLBackend(db, SQLOptions{
+		BatchOptions: BatchOptions{MaxRecords: 1},
+		Columns:      SQLColumns{Level: "severity", Message: "text"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Error("lost")
+	log.Error("kept")
+	backend.Close()
+
+	execs := d.executed()
+	if len(execs) != 1 || execs[0].query != "INSERT INTO logs (severity, text) VALUES (?, ?)" {
+		t.Fatalf("unexpected statements %+v", execs)
+	}
+	if execs[0].args[0] != "error" || execs[0].args[1] != "kept" {
+		t.Errorf("unexpected arguments %v", execs[0].args)
+	}
+	if stats := backend.Stats(); stats.Sent != 1 || stats.Failed != 1 || stats.Retries != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "no such table") {
+		t.Errorf("unexpected errors %v", reported)
+	}
+}
+
+func TestSQLBackendMaxBytes(t *testing.T) {
+	InitForTesting(DEBUG)
+	db, d := openFakeDB(t)
+	defer db.Close()
+
+	backend, err := NewSQLBackend(db, SQLOptions{
+		BatchOptions: BatchOptions{MaxBytes: 10, MaxLatency: time.Hour},
+		Columns:      SQLColumns{Message: "message"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("12345678")
+	log.Info("12345678")
+	backend.Close()
+
+	if execs := d.executed(); len(execs) != 2 {
+		t.Errorf("messages not counted in the batch size: %+v", execs)
+	}
+}
+
+func TestNewSQLBackendInvalidIdentifier(t *testing.T) {
+	db, _ := openFakeDB(t)
+	defer db.Close()
+
+	for _, opts := range []SQLOptions{
+		{Table: "logs; DROP TABLE users"},
+		{Table: "1logs"},
+		{Columns: SQLColumns{Message: `"message"`}},
+	} {
+		if _, err := NewSQLBackend(db, opts); err == nil {
+			t.Errorf("%+v: expected error", opts)
+		}
+	}
+	backend, err := NewSQLBackend(db, SQLOptions{Table: "audit.logs_2024"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Close()
+}
@@ -9,7 +9,8 @@ package logging
 import "log/syslog"
 
 // SyslogBackend is a simple logger to syslog backend. It automatically maps
-// the internal log levels to appropriate syslog log levels.
+// the internal log levels to appropriate syslog log levels, see
+// Level.Severity.
 type SyslogBackend struct {
 	Writer *syslog.Writer
 }
@@ -34,18 +35,22 @@ func NewSyslogBackendPriority(prefix string, priority syslog.Priority) (b *Syslo
 // Log implements the Backend interface.
 func (b *SyslogBackend) Log(level Level, calldepth int, rec *Record) error {
 	line := rec.Formatted(calldepth + 1)
-	switch level {
-	case CRITICAL:
+	switch level.Severity() {
+	case SeverityEmerg:
+		return b.Writer.Emerg(line)
+	case SeverityAlert:
+		return b.Writer.Alert(line)
+	case SeverityCrit:
 		return b.Writer.Crit(line)
-	case ERROR:
+	case SeverityErr:
 		return b.Writer.Err(line)
-	case WARNING:
+	case SeverityWarning:
 		return b.Writer.Warning(line)
-	case NOTICE:
+	case SeverityNotice:
 		return b.Writer.Notice(line)
-	case INFO:
+	case SeverityInfo:
 		return b.Writer.Info(line)
-	case DEBUG:
+	case SeverityDebug:
 		return b.Writer.Debug(line)
 	default:
 	}
@@ -0,0 +1,261 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SyslogFormat is the syslog message format written by a SyslogNetBackend.
+type SyslogFormat int
+
+// Syslog message formats.
+const (
+	// RFC5424 is the format of the syslog protocol, with structured data.
+	RFC5424 SyslogFormat = iota
+	// RFC3164 is the BSD syslog format, understood by older daemons.
+	RFC3164
+)
+
+// Facility is a syslog facility.
+type Facility int
+
+// Syslog facilities, as defined in RFC 5424.
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	FacilityNTP
+	FacilityAudit
+	FacilityAlert
+	FacilityClock
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// defaultSDID is the SD-ID of the structured data element holding the fields
+// of a record, using the enterprise number reserved for documentation.
+const defaultSDID = "fields@32473"
+
+// SyslogOptions configure a SyslogNetBackend.
+type SyslogOptions struct {
+	// NetworkOptions configure the connection to the syslog daemon. Over
+	// tcp, RFC 5425 and RFC 6587 expect OctetCountingFraming.
+	NetworkOptions
+	// Format is the message format, RFC5424 by default.
+	Format SyslogFormat
+	// Facility is the facility of modules without a facility set with
+	// SetFacility, FacilityUser if nil.
+	Facility *Facility
+	// Hostname defaults to the name of the host.
+	Hostname string
+	// AppName is the APP-NAME, or TAG of RFC 3164 messages. It defaults to
+	// the name of the program.
+	AppName string
+	// MsgID returns the MSGID of a record. It defaults to the module name.
+	MsgID func(*Record) string
+	// SDID is the SD-ID of the element holding the fields of a record. It
+	// defaults to "fields@32473".
+	SDID string
+}
+
+// SyslogNetBackend writes records to a syslog daemon over a unix socket, udp,
+// tcp or tcp with TLS. Unlike SyslogBackend, it does not depend on log/syslog
+// and sets the facility and MSGID per module and the fields of a record as
+// structured data.
+type SyslogNetBackend struct {
+	opts     SyslogOptions
+	facility Facility
+	procID   string
+	conn   *NetworkBackend
+
+	mu         sync.RWMutex
+	facilities []facilityRule
+}
+
+// facilityRule sets the facility of the modules matching a pattern.
+type facilityRule struct {
+	pattern  string
+	match    func(string) bool
+	facility Facility
+}
+
+// NewSyslogNetBackend creates a SyslogNetBackend writing to addr on network,
+// eg. "unixgram" and "/dev/log" for the local daemon, or "udp" and
+// "localhost:514".
+func NewSyslogNetBackend(network, addr string, opts SyslogOptions) (*SyslogNetBackend, error) {
+	facility := FacilityUser
+	if opts.Facility != nil {
+		facility = *opts.Facility
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	if opts.MsgID == nil {
+		opts.MsgID = func(rec *Record) string { return rec.Module }
+	}
+	if opts.SDID == "" {
+		opts.SDID = defaultSDID
+	}
+	conn, err := NewNetworkBackend(network, addr, opts.NetworkOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogNetBackend{
+		opts:     opts,
+		facility: facility,
+		procID:   strconv.Itoa(os.Getpid()),
+		conn:     conn,
+	}, nil
+}
+
+// SetFacility sets the facility of the modules matching pattern, see
+// CompileModulePattern. The first matching pattern wins, setting the same
+// pattern again replaces its facility.
+func (b *SyslogNetBackend) SetFacility(pattern string, facility Facility) error {
+	match, err := CompileModulePattern(pattern)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := range b.facilities {
+		if b.facilities[i].pattern == pattern {
+			b.facilities[i].facility = facility
+			return nil
+		}
+	}
+	b.facilities = append(b.facilities, facilityRule{pattern, match, facility})
+	return nil
+}
+
+// Facility returns the facility of module.
+func (b *SyslogNetBackend) Facility(module string) Facility {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, rule := range b.facilities {
+		if rule.match(module) {
+			return rule.facility
+		}
+	}
+	return b.facility
+}
+
+// Connected returns true if the backend is connected to the syslog daemon.
+func (b *SyslogNetBackend) Connected() bool {
+	return b.conn.Connected()
+}
+
+// Close closes the connection to the syslog daemon.
+func (b *SyslogNetBackend) Close() error {
+	return b.conn.Close()
+}
+
+// Log implements the Backend interface.
+func (b *SyslogNetBackend) Log(level Level, calldepth int, rec *Record) error {
+	return b.conn.send(b.message(level, rec.Formatted(calldepth+1), rec))
+}
+
+// message formats the syslog message of rec.
+func (b *SyslogNetBackend) message(level Level, msg string, rec *Record) string {
+	pri := int(b.Facility(rec.Module))*8 + int(level.Severity())
+	var buf strings.Builder
+	buf.WriteString("<" + strconv.Itoa(pri) + ">")
+
+	if b.opts.Format == RFC3164 {
+		buf.WriteString(rec.Time.Format("Jan _2 15:04:05") + " ")
+		buf.WriteString(syslogHeaderField(b.opts.Hostname, 255) + " ")
+		buf.WriteString(syslogHeaderField(b.opts.AppName, 32) + "[" + b.procID + "]: ")
+		buf.WriteString(msg)
+		return buf.String()
+	}
+
+	buf.WriteString("1 ")
+	buf.WriteString(rec.Time.Format("2006-01-02T15:04:05.000000Z07:00") + " ")
+	buf.WriteString(syslogHeaderField(b.opts.Hostname, 255) + " ")
+	buf.WriteString(syslogHeaderField(b.opts.AppName, 48) + " ")
+	buf.WriteString(syslogHeaderField(b.procID, 128) + " ")
+	buf.WriteString(syslogHeaderField(b.opts.MsgID(rec), 32) + " ")
+	buf.WriteString(b.structuredData(rec.Fields))
+	if msg != "" {
+		buf.WriteString(" " + msg)
+	}
+	return buf.String()
+}
+
+// structuredData renders fields as a single STRUCTURED-DATA element.
+func (b *SyslogNetBackend) structuredData(fields Fields) string {
+	if len(fields) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	buf.WriteString("[" + b.opts.SDID)
+	for _, k := range keys {
+		buf.WriteString(" " + syslogParamName(k) + `="`)
+		buf.WriteString(sdEscaper.Replace(fmt.Sprint(fields[k])))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
+
+// sdEscaper escapes the characters not allowed in a PARAM-VALUE.
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// syslogHeaderField returns s as a header field of at most max printable
+// characters, or the NILVALUE "-" if empty.
+func syslogHeaderField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// syslogParamName returns name as a PARAM-NAME, which can not contain '=',
+// ']' nor '"' and is at most 32 characters long.
+func syslogParamName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	return syslogHeaderField(name, 32)
+}
@@ -0,0 +1,178 @@
+package logging
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readDatagram reads the next datagram received on conn.
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestSyslogNetBackendRFC5424(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 123456000, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	backend, err := NewSyslogNetBackend("udp", conn.LocalAddr().String(), SyslogOptions{
+		Hostname: "host",
+		AppName:  "my app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	if err := backend.SetFacility("db*", FacilityLocal0); err != nil {
+		t.Fatal(err)
+	}
+
+	pid := strconv.Itoa(os.Getpid())
+	log := MustGetLogger("http")
+	log.SetBackend(AddModuleLevel(backend))
+	log.WithFields(Fields{"path": `/a"b]`, "status": 200}).Info("served")
+	expected := `<14>1 2024-03-01T10:20:30.123456Z host my_app ` + pid + ` http [fields@32473 path="/a\"b\]" status="200"] served`
+	if got := readDatagram(t, conn); got != expected {
+		t.Errorf("unexpected message\n%q\n%q", got, expected)
+	}
+
+	db := MustGetLogger("db.sql")
+	db.SetBackend(AddModuleLevel(backend))
+	db.Error("failed")
+	expected = `<131>1 2024-03-01T10:20:30.123456Z host my_app ` + pid + ` db.sql - failed`
+	if got := readDatagram(t, conn); got != expected {
+		t.Errorf("unexpected message\n%q\n%q", got, expected)
+	}
+}
+
+func TestSyslogNetBackendRFC3164(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := collector(t, ln)
+
+	daemon := FacilityDaemon
+	backend, err := NewSyslogNetBackend("tcp", ln.Addr().String(), SyslogOptions{
+		Format:   RFC3164,
+		Facility: &daemon,
+		Hostname: "host",
+		AppName:  "app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Warning("disk almost full")
+	expectLines(t, lines, "<28>Mar  1 10:20:30 host app["+strconv.Itoa(os.Getpid())+"]: disk almost full")
+}
+
+func TestSyslogNetBackendUnix(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("unix sockets not supported")
+	}
+	InitForTesting(DEBUG)
+
+	path := filepath.Join(t.TempDir(), "log")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	backend, err := NewSyslogNetBackend("unixgram", path, SyslogOptions{
+		MsgID: func(rec *Record) string { return "ID" + strconv.Itoa(int(rec.ID)) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Info("hello")
+	msg := readDatagram(t, conn)
+	if len(msg) < 4 || msg[:4] != "<14>" {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestSyslogNetBackendFacilityKern(t *testing.T) {
+	InitForTesting(DEBUG)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	kern := FacilityKern
+	backend, err := NewSyslogNetBackend("udp", conn.LocalAddr().String(), SyslogOptions{
+		Facility: &kern,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	log.Error("oops")
+	msg := readDatagram(t, conn)
+	if len(msg) < 3 || msg[:3] != "<3>" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	if strings.HasSuffix(msg, "\n") {
+		t.Errorf("unexpected newline in datagram %q", msg)
+	}
+}
+
+func TestSyslogHeaderField(t *testing.T) {
+	cases := []struct {
+		in       string
+		max      int
+		expected string
+	}{
+		{"", 10, "-"},
+		{"app", 10, "app"},
+		{"my app\n", 10, "my_app_"},
+		{"verylongname", 4, "very"},
+	}
+	for _, c := range cases {
+		if got := syslogHeaderField(c.in, c.max); got != c.expected {
+			t.Errorf("%q: expected %q, got %q", c.in, c.expected, got)
+		}
+	}
+	if got := syslogParamName(`a=b"c]`); got != "a_b_c_" {
+		t.Errorf("unexpected param name %q", got)
+	}
+}
@@ -0,0 +1,318 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Templates of the payloads of common chat webhooks, to be parsed with
+// ParseWebhookTemplate.
+const (
+	// SlackTemplate posts the alert as the text of a Slack or Mattermost
+	// message.
+	SlackTemplate = `{"text":{{json (printf "*%s* %s: %s%s" .Level .Module .Message .Repeated)}}}`
+	// TeamsTemplate posts the alert as a Microsoft Teams message card.
+	TeamsTemplate = `{"@type":"MessageCard","@context":"https://schema.org/extensions",` +
+		`"summary":{{json .Message}},"title":{{json (printf "%s %s on %s" .Level .Module .Host)}},` +
+		`"text":{{json (printf "%s%s" .Message .Repeated)}}}`
+)
+
+// WebhookOptions configure a WebhookBackend.
+type WebhookOptions struct {
+	// Template renders the JSON payload of an alert from a WebhookAlert.
+	// It defaults to SlackTemplate.
+	Template *template.Template
+	// Key returns the key under which alerts are de-duplicated, by default
+	// the module and the message of the record.
+	Key func(rec *Record) string
+	// Cooldown is the time during which the alerts with the same key as a
+	// posted alert are suppressed. It defaults to 5 minutes.
+	Cooldown time.Duration
+	// Header is added to each request.
+	Header http.Header
+	// Client posts the alerts, a client with a 10 seconds timeout by
+	// default.
+	Client *http.Client
+	// QueueSize is the number of alerts waiting to be posted, alerts are
+	// dropped once it is full. It defaults to 100.
+	QueueSize int
+}
+
+// WebhookAlert is the data rendered by the template of a WebhookBackend.
+type WebhookAlert struct {
+	Time     time.Time
+	Level    string
+	Module   string
+	Message  string
+	Fields   Fields
+	File     string
+	Line     int
+	Function string
+	Host     string
+	Program  string
+	// Suppressed is the number of alerts with the same key suppressed since
+	// the previous alert was posted.
+	Suppressed int
+}
+
+// Repeated describes the suppressed alerts, eg. " (repeated 3 times)", or is
+// empty if there are none.
+func (a *WebhookAlert) Repeated() string {
+	if a.Suppressed == 0 {
+		return ""
+	}
+	return " (repeated " + strconv.Itoa(a.Suppressed) + " times)"
+}
+
+// ParseWebhookTemplate parses the template of a webhook payload. The template
+// may use the json function to quote values.
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+// WebhookBackend posts records as alerts to a chat webhook, eg. Slack,
+// Mattermost or Microsoft Teams. Alerts with the same key are posted at most
+// once per cool-down, the following ones being counted in the next alert, or
+// once the cool-down ended, the last of them is posted counting the others.
+// Alerts are posted in order from a goroutine of the backend. It is meant to
+// receive only critical records:
+//
+//	alerts := AddModuleLevel(NewWebhookBackend(url, WebhookOptions{}))
+//	alerts.SetLevel(CRITICAL, "")
+type WebhookBackend struct {
+	url     string
+	opts    WebhookOptions
+	host    string
+	program string
+
+	mu     sync.Mutex
+	alerts map[string]*webhookState
+
+	queue chan *webhookPost
+	flush chan chan struct{}
+	done  chan struct{}
+
+	qmu    sync.RWMutex // guards closed and queue against close
+	closed bool
+}
+
+// webhookState is the state of the alerts with the same key.
+type webhookState struct {
+	posted     time.Time
+	suppressed int
+	last       *webhookPost // the last suppressed alert
+}
+
+// webhookPost is an alert waiting to be posted.
+type webhookPost struct {
+	alert *WebhookAlert
+	state *webhookState
+	rec   *Record
+}
+
+var defaultWebhookTemplate = template.Must(ParseWebhookTemplate(SlackTemplate))
+
+// NewWebhookBackend creates a WebhookBackend posting to url. Close should be
+// called to post the pending alerts before the program exits.
+func NewWebhookBackend(url string, opts WebhookOptions) *WebhookBackend {
+	if opts.Template == nil {
+		opts.Template = defaultWebhookTemplate
+	}
+	if opts.Key == nil {
+		opts.Key = func(rec *Record) string {
+			return rec.Module + "\x00" + rec.Message()
+		}
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 5 * time.Minute
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+	host, _ := os.Hostname()
+	b := &WebhookBackend{
+		url:     url,
+		opts:    opts,
+		host:    host,
+		program: filepath.Base(os.Args[0]),
+		alerts:  make(map[string]*webhookState),
+		queue:   make(chan *webhookPost, opts.QueueSize),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Log implements the Backend interface. Records suppressed by the cool-down
+// are not an error, failing to post an alert is reported to the error
+// handler.
+func (b *WebhookBackend) Log(level Level, calldepth int, rec *Record) error {
+	alert := &WebhookAlert{
+		Time:    rec.Time,
+		Level:   rec.Level.String(),
+		Module:  rec.Module,
+		Message: rec.Message(),
+		Fields:  rec.Fields,
+		Host:    b.host,
+		Program: b.program,
+	}
+	if frame, ok := rec.Caller(calldepth + 1); ok {
+		alert.File, alert.Line, alert.Function = filepath.Base(frame.File), frame.Line, frame.Function
+	}
+
+	key := b.opts.Key(rec)
+	now := timeNow()
+	b.mu.Lock()
+	state, ok := b.alerts[key]
+	if ok && now.Sub(state.posted) < b.opts.Cooldown {
+		state.suppressed++
+		state.last = &webhookPost{alert, state, rec}
+		b.mu.Unlock()
+		return nil
+	}
+	if !ok {
+		state = &webhookState{}
+		b.alerts[key] = state
+	}
+	alert.Suppressed = state.suppressed
+	state.posted, state.suppressed, state.last = now, 0, nil
+	b.mu.Unlock()
+
+	p := &webhookPost{alert, state, rec}
+	b.qmu.RLock()
+	defer b.qmu.RUnlock()
+	if b.closed {
+		b.unpost(p)
+		return errClosed
+	}
+	select {
+	case b.queue <- p:
+		return nil
+	default:
+		b.unpost(p)
+		return ErrQueueFull
+	}
+}
+
+// unpost lets the next record with the key of an alert not posted post it
+// again, counting the alert and those it was counting as suppressed.
+func (b *WebhookBackend) unpost(p *webhookPost) {
+	b.mu.Lock()
+	p.state.posted = time.Time{}
+	p.state.suppressed += p.alert.Suppressed + 1
+	if p.state.last == nil {
+		p.state.last = p
+	}
+	b.mu.Unlock()
+}
+
+// Flush posts the queued alerts and waits until they are posted.
+func (b *WebhookBackend) Flush() {
+	b.qmu.RLock()
+	if b.closed {
+		b.qmu.RUnlock()
+		return
+	}
+	ch := make(chan struct{})
+	b.flush <- ch
+	b.qmu.RUnlock()
+	<-ch
+}
+
+// Close posts the queued alerts and stops the backend.
+func (b *WebhookBackend) Close() {
+	b.qmu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.qmu.Unlock()
+	<-b.done
+}
+
+func (b *WebhookBackend) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.opts.Cooldown)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.expire(timeNow())
+		case p, ok := <-b.queue:
+			if !ok {
+				return
+			}
+			b.send(p)
+		case ch := <-b.flush:
+			// post the alerts queued before the flush
+			for n := len(b.queue); n > 0; n-- {
+				b.send(<-b.queue)
+			}
+			close(ch)
+		}
+	}
+}
+
+// send posts p, reporting failures.
+func (b *WebhookBackend) send(p *webhookPost) {
+	if err := b.post(p.alert); err != nil {
+		b.unpost(p)
+		reportError(err, p.rec)
+	}
+}
+
+// expire forgets the keys whose cool-down ended, posting the last alert
+// suppressed during the cool-down, counting the others.
+func (b *WebhookBackend) expire(now time.Time) {
+	var posts []*webhookPost
+	b.mu.Lock()
+	for key, state := range b.alerts {
+		if now.Sub(state.posted) < b.opts.Cooldown {
+			continue
+		}
+		delete(b.alerts, key)
+		if p := state.last; p != nil {
+			p.alert.Suppressed = state.suppressed - 1
+			posts = append(posts, p)
+		}
+	}
+	b.mu.Unlock()
+	for _, p := range posts {
+		if err := b.post(p.alert); err != nil {
+			reportError(err, p.rec)
+		}
+	}
+}
+
+func (b *WebhookBackend) post(alert *WebhookAlert) error {
+	var body bytes.Buffer
+	if err := b.opts.Template.Execute(&body, alert); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", b.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range b.opts.Header {
+		req.Header[k] = v
+	}
+	_, err = doHTTP(b.opts.Client, req)
+	return err
+}
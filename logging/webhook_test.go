@@ -0,0 +1,242 @@
+package logging
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// webhookStandIn records the payloads posted to it, failing with 500 while
+// fail is set.
+type webhookStandIn struct {
+	mu       sync.Mutex
+	payloads []map[string]interface{}
+	fail     bool
+}
+
+func (s *webhookStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	var payload map[string]interface{}
+	if r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(body, &payload) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.payloads = append(s.payloads, payload)
+}
+
+func (s *webhookStandIn) texts(key string) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var texts []interface{}
+	for _, p := range s.payloads {
+		texts = append(texts, p[key])
+	}
+	return texts
+}
+
+func TestWebhookBackend(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	standIn := &webhookStandIn{}
+	ts := httptest.NewServer(standIn)
+	defer ts.Close()
+
+	backend := NewWebhookBackend(ts.URL, WebhookOptions{Cooldown: time.Minute})
+	defer backend.Close()
+	alerts := AddModuleLevel(backend)
+	alerts.SetLevel(CRITICAL, "")
+	log := MustGetLogger("db")
+	log.SetBackend(alerts)
+
+	log.Error("not an alert")
+	for i := 0; i < 3; i++ {
+		log.Critical("crashed")
+	}
+	log.Critical("other")
+	now = now.Add(30 * time.Second)
+	log.Critical("crashed")
+	now = now.Add(31 * time.Second)
+	log.Critical("crashed")
+	log.Critical("crashed")
+
+	// the post failing, the next record posts the alert
+	now = now.Add(2 * time.Minute)
+	var reported []error
+	SetErrorHandler(func(err error, rec *Record) { reported = append(reported, err) })
+	defer SetErrorHandler(RateLimitedErrorHandler(os.Stderr, defaultErrorInterval))
+	backend.Flush()
+	standIn.fail = true
+	log.Critical("crashed")
+	backend.Flush()
+	standIn.fail = false
+	log.Critical("crashed")
+	backend.Flush()
+
+	expected := []interface{}{
+		"*CRIT* db: crashed",
+		"*CRIT* db: other",
+		"*CRIT* db: crashed (repeated 3 times)",
+		"*CRIT* db: crashed (repeated 2 times)",
+	}
+	if len(reported) != 1 {
+		t.Errorf("unexpected errors %v", reported)
+	}
+	texts := standIn.texts("text")
+	if len(texts) != len(expected) {
+		t.Fatalf("unexpected alerts %q", texts)
+	}
+	for i := range expected {
+		if texts[i] != expected[i] {
+			t.Errorf("alert %d: %q != %q", i, texts[i], expected[i])
+		}
+	}
+}
+
+func TestWebhookBackendTemplate(t *testing.T) {
+	InitForTesting(DEBUG)
+	standIn := &webhookStandIn{}
+	ts := httptest.NewServer(standIn)
+	defer ts.Close()
+
+	custom := mustParseWebhookTemplate(t, `{"text":{{json .Message}},"where":{{json (printf "%s:%d" .File .Line)}},"user":{{json .Fields.user}}}`)
+	backends := []*WebhookBackend{
+		NewWebhookBackend(ts.URL, WebhookOptions{Template: mustParseWebhookTemplate(t, TeamsTemplate)}),
+		NewWebhookBackend(ts.URL, WebhookOptions{
+			Template: custom,
+			Key:      func(rec *Record) string { return rec.Module },
+		}),
+	}
+	log := MustGetLogger("api")
+	for _, b := range backends {
+		log.SetBackend(AddModuleLevel(b))
+		log.WithFields(Fields{"user": "bob"}).Critical(`"quoted"`)
+		log.Critical("same key")
+		b.Close()
+	}
+
+	standIn.mu.Lock()
+	defer standIn.mu.Unlock()
+	if len(standIn.payloads) != 3 {
+		t.Fatalf("unexpected payloads %v", standIn.payloads)
+	}
+	teams := standIn.payloads[0]
+	if teams["@type"] != "MessageCard" || teams["summary"] != `"quoted"` || teams["text"] != `"quoted"` {
+		t.Errorf("unexpected teams payload %v", teams)
+	}
+	expected := map[string]interface{}{"text": `"quoted"`, "where": "webhook_test.go:127", "user": "bob"}
+	for k, v := range expected {
+		if standIn.payloads[2][k] != v {
+			t.Errorf("unexpected %s: %v != %v", k, standIn.payloads[2][k], v)
+		}
+	}
+}
+
+func mustParseWebhookTemplate(t *testing.T, text string) *template.Template {
+	tmpl, err := ParseWebhookTemplate(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+func TestWebhookBackendQueueFull(t *testing.T) {
+	InitForTesting(DEBUG)
+	release := make(chan struct{})
+	posted := make(chan struct{}, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted <- struct{}{}
+		<-release
+	}))
+	defer ts.Close()
+
+	backend := NewWebhookBackend(ts.URL, WebhookOptions{QueueSize: 1})
+	log := MustGetLogger("test")
+	log.SetBackend(AddModuleLevel(backend))
+	var errs []error
+	log.SetErrorHandler(func(err error, rec *Record) { errs = append(errs, err) })
+
+	// a blocks the worker, b is queued and c dropped
+	log.Critical("a")
+	<-posted
+	log.Critical("b")
+	log.Critical("c")
+	close(release)
+	backend.Close()
+
+	if len(errs) != 1 || errs[0] != ErrQueueFull {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if len(posted) != 1 {
+		t.Errorf("expected b to be posted after a, got %d more posts", len(posted))
+	}
+	if state := backend.alerts["test\x00c"]; state == nil || state.suppressed != 1 || !state.posted.IsZero() {
+		t.Errorf("dropped alert not counted as suppressed: %+v", state)
+	}
+	log.Critical("closed")
+	if len(errs) != 2 || errs[1] != errClosed {
+		t.Errorf("unexpected errors after Close %v", errs)
+	}
+}
+
+func TestWebhookBackendExpire(t *testing.T) {
+	InitForTesting(DEBUG)
+	now := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	standIn := &webhookStandIn{}
+	ts := httptest.NewServer(standIn)
+	defer ts.Close()
+
+	backend := NewWebhookBackend(ts.URL, WebhookOptions{Cooldown: time.Minute})
+	defer backend.Close()
+	log := MustGetLogger("db")
+	log.SetBackend(AddModuleLevel(backend))
+
+	for i := 0; i < 3; i++ {
+		log.Critical("crashed")
+	}
+	log.Critical("other")
+	backend.Flush()
+	backend.expire(now.Add(30 * time.Second))
+	now = now.Add(time.Minute)
+	backend.expire(now)
+	log.Critical("crashed")
+	backend.Flush()
+
+	expected := []interface{}{
+		"*CRIT* db: crashed",
+		"*CRIT* db: other",
+		"*CRIT* db: crashed (repeated 1 times)",
+		"*CRIT* db: crashed",
+	}
+	texts := standIn.texts("text")
+	if len(texts) != len(expected) {
+		t.Fatalf("unexpected alerts %q", texts)
+	}
+	for i := range expected {
+		if texts[i] != expected[i] {
+			t.Errorf("alert %d: %q != %q", i, texts[i], expected[i])
+		}
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if len(backend.alerts) != 1 {
+		t.Errorf("expected the expired keys to be forgotten, got %d keys", len(backend.alerts))
+	}
+}